@@ -4,5 +4,10 @@ go 1.21.4
 
 require (
 	github.com/tidwall/resp v0.1.1
+	github.com/youmark/pkcs8 v0.0.0-20240726163527-a2c0da244d78
+	golang.org/x/sys v0.28.0
 	gopkg.in/yaml.v3 v3.0.1
+	software.sslmate.com/src/go-pkcs12 v0.7.3
 )
+
+require golang.org/x/crypto v0.31.0 // indirect
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+)
+
+// ExitAuthFailed is the exit code used when the server rejects the credentials.
+const ExitAuthFailed = 3
+
+// PasswordEnv is the environment variable the password is read from when --pass is not set.
+const PasswordEnv = "ECHOVAULT_PASSWORD"
+
+// AuthError is returned when the server replies to AUTH with an error.
+type AuthError struct {
+	User  string
+	Reply string
+}
+
+func (e *AuthError) Error() string {
+	if len(e.User) > 0 {
+		return fmt.Sprintf("authentication failed for user %q: %s", e.User, e.Reply)
+	}
+	return fmt.Sprintf("authentication failed: %s", e.Reply)
+}
+
+// ResolvePassword prompts for the password when a user is given without one, so
+// that it is only asked for once rather than on every reconnect.
+func (conf *Config) ResolvePassword() error {
+	if len(conf.Username) == 0 || len(conf.Password) > 0 {
+		return nil
+	}
+	password, err := PromptPassword(conf.Username)
+	if err != nil {
+		return err
+	}
+	conf.Password = password
+	return nil
+}
+
+// PromptPassword asks for the password of user on the terminal without echoing it.
+func PromptPassword(user string) (string, error) {
+	password, err := PromptSecret("Password for " + user + ": ")
+	if errors.Is(err, errNoTerminal) {
+		return "", noPasswordError(user)
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not prompt for the password of user %q (%s): use --pass or set %s", user, err, PasswordEnv)
+	}
+	return password, nil
+}
+
+// errNoTerminal is returned by PromptSecret when there is no terminal to prompt on.
+var errNoTerminal = errors.New("no terminal")
+
+// PromptSecret writes prompt to stderr and reads a line from the terminal without echoing it.
+func PromptSecret(prompt string) (string, error) {
+	tty, err := os.OpenFile(ttyPath, os.O_RDWR, 0)
+	if err != nil {
+		if !IsTerminal(os.Stdin) {
+			return "", errNoTerminal
+		}
+		tty = os.Stdin
+	} else {
+		defer tty.Close()
+	}
+
+	restore, err := DisableEcho(tty)
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	// Restore the terminal if the prompt is interrupted.
+	interrupt := make(chan os.Signal, 1)
+	defer close(interrupt)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	go func() {
+		if _, ok := <-interrupt; ok {
+			restore()
+			os.Exit(130)
+		}
+	}()
+
+	fmt.Fprint(os.Stderr, prompt)
+	line, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil && len(line) == 0 {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// handshake authenticates and selects the database given in conf on a new connection.
+func handshake(conn net.Conn, conf Config) error {
+	if len(conf.Username) > 0 && len(conf.Password) == 0 {
+		// Without a password the connection would silently use the default user.
+		return noPasswordError(conf.Username)
+	}
+
+	var commands [][]string
+	if len(conf.Password) > 0 {
+		if len(conf.Username) > 0 {
+			commands = append(commands, []string{"AUTH", conf.Username, conf.Password})
+		} else {
+			commands = append(commands, []string{"AUTH", conf.Password})
+		}
+	}
+	if conf.Database > 0 {
+		commands = append(commands, []string{"SELECT", strconv.Itoa(conf.Database)})
+	}
+
+	r := NewRespReader(conn)
+	for _, tokens := range commands {
+		if _, err := conn.Write([]byte(EncodeTokens(tokens))); err != nil {
+			return err
+		}
+		reply, err := r.ReadValue()
+		if err != nil {
+			return err
+		}
+		if reply.Type().String() == "Error" {
+			if tokens[0] == "AUTH" {
+				return &AuthError{User: conf.Username, Reply: reply.String()}
+			}
+			return fmt.Errorf("%s: %s", tokens[0], reply.String())
+		}
+	}
+	return nil
+}
+
+func noPasswordError(user string) error {
+	return fmt.Errorf("no password for user %q: use --pass or set %s", user, PasswordEnv)
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/tidwall/resp"
+)
+
+// PipelineCommand is a command to be sent by Pipeline.
+type PipelineCommand struct {
+	Data   []byte   // The encoded command.
+	Label  string   // Identifies the command in error messages.
+	Tokens []string // The command name and arguments. Only required for recording.
+}
+
+// PipelineResult is the outcome of a pipelined run.
+type PipelineResult struct {
+	Sent    int   // Commands written to the connection.
+	Replies int   // Replies read from the connection.
+	Failed  int   // Replies that were RESP errors.
+	Err     error // The error that stopped the run early, if any.
+}
+
+// Pipeline writes the commands returned by next to conn without waiting for
+// their replies. At most window commands are in flight at any time. Replies
+// are read concurrently and matched to commands in the order they were sent;
+// error replies are written to stderr prefixed with the label of the command
+// that caused them. Successful commands are recorded with rec, which may be nil.
+// If timeout is not zero, the run stops when a reply does not arrive within timeout
+// of its command being sent. next returns io.EOF once there are no more commands.
+func Pipeline(conn net.Conn, window int, timeout time.Duration, next func() (PipelineCommand, error), rec *Recorder, stderr io.Writer) PipelineResult {
+	if window < 1 {
+		window = 1
+	}
+
+	cw, cr := bufio.NewWriter(conn), NewRespReader(conn)
+
+	pending := make(chan PipelineCommand, window)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	var res PipelineResult
+	var readErr, writeErr error
+	// flushed counts the commands that have reached the server rather than the write buffer.
+	var flushed atomic.Int64
+
+	go func() {
+		defer close(done)
+		for comm := range pending {
+			var decoded resp.Value
+			var err error
+			for {
+				// A command may still be buffered while the next one is read from the input,
+				// so the timeout only counts once the command has been flushed.
+				sent := flushed.Load() > int64(res.Replies)
+				if timeout > 0 {
+					conn.SetReadDeadline(time.Now().Add(timeout))
+				}
+				decoded, err = cr.ReadValue()
+				if sent || !isTimeout(err) || cr.Partial() {
+					break
+				}
+			}
+			if err != nil {
+				readErr = err
+				if isTimeout(err) {
+					readErr = fmt.Errorf("%s: no reply within %s", comm.Label, timeout)
+				}
+				close(stop)
+				// Drain the remaining commands so the writer is never blocked.
+				for range pending {
+				}
+				return
+			}
+			res.Replies++
+			if decoded.Type().String() == "Error" {
+				res.Failed++
+				fmt.Fprintf(stderr, "%s: %s\n", comm.Label, decoded.String())
+			}
+			if err = rec.Record(comm.Tokens, decoded); err != nil {
+				fmt.Fprintf(stderr, "%s: could not record command: %s\n", comm.Label, err)
+			}
+		}
+	}()
+
+send:
+	for {
+		comm, err := next()
+		if err != nil {
+			if err != io.EOF {
+				writeErr = err
+			}
+			break
+		}
+
+		if _, err = cw.Write(comm.Data); err != nil {
+			writeErr = err
+			break
+		}
+		res.Sent++
+
+		select {
+		case pending <- comm:
+			// When this is the only command in flight the server is idle, so send it
+			// straight away rather than waiting for the window to fill up.
+			if len(pending) <= 1 {
+				if err = cw.Flush(); err != nil {
+					writeErr = err
+					break send
+				}
+				flushed.Store(int64(res.Sent))
+			}
+			continue
+		case <-stop:
+			break send
+		default:
+		}
+
+		// The window is full. Flush what has been buffered so that the server
+		// can reply and free up space in the window.
+		if err = cw.Flush(); err != nil {
+			writeErr = err
+			break
+		}
+		flushed.Store(int64(res.Sent))
+		select {
+		case pending <- comm:
+		case <-stop:
+			break send
+		}
+	}
+
+	if err := cw.Flush(); err != nil && writeErr == nil {
+		writeErr = err
+	}
+	flushed.Store(int64(res.Sent))
+	close(pending)
+	<-done
+
+	switch {
+	case writeErr != nil:
+		res.Err = writeErr
+	case readErr != nil && IsConnectionClosed(readErr):
+		res.Err = errors.New("connection closed")
+	case readErr != nil:
+		res.Err = readErr
+	}
+
+	return res
+}
+
+// RunBatch reads commands from r, one per line, and pipelines them to the server.
+// Blank lines and lines starting with '#' are skipped. A summary is written to
+// stdout once all replies have been read. It returns the process exit code.
+func RunBatch(conn net.Conn, r io.Reader, window int, timeout time.Duration, rec *Recorder, stdout, stderr io.Writer) int {
+	start := time.Now()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 512*1024*1024)
+
+	var lineNo, total, invalid int
+
+	next := func() (PipelineCommand, error) {
+		for scanner.Scan() {
+			lineNo++
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" || strings.HasPrefix(text, "#") {
+				continue
+			}
+
+			total++
+
+			tokens, err := tokenize(text)
+			if err != nil {
+				invalid++
+				fmt.Fprintf(stderr, "line %d: %s: could not parse command\n", lineNo, text)
+				continue
+			}
+
+			return PipelineCommand{
+				Data:   []byte(EncodeTokens(tokens)),
+				Label:  fmt.Sprintf("line %d: %s", lineNo, text),
+				Tokens: tokens,
+			}, nil
+		}
+		if err := scanner.Err(); err != nil {
+			return PipelineCommand{}, err
+		}
+		return PipelineCommand{}, io.EOF
+	}
+
+	res := Pipeline(conn, window, timeout, next, rec, stderr)
+	if res.Err != nil {
+		fmt.Fprintln(stderr, res.Err)
+	}
+
+	failed := res.Failed + invalid
+
+	fmt.Fprintf(stdout, "commands: %d, errors: %d, elapsed: %s\n",
+		total, failed, time.Since(start).Round(time.Millisecond))
+
+	if failed > 0 || res.Err != nil {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// certReloadInterval is how often interactive sessions check the client certificate files for changes.
+const certReloadInterval = 10 * time.Second
+
+// ClientCertificates holds the client certificates loaded from the CertKeyPairs of a
+// config. Watch reloads them when their files change, so that the connections made
+// after a certificate is rotated present the new one.
+type ClientCertificates struct {
+	pairs      [][]string
+	passphrase string
+
+	mu    sync.RWMutex
+	certs []tls.Certificate
+	// stamp identifies the versions of the files the certificates were last loaded from.
+	stamp string
+}
+
+// LoadClientCertificates loads the cert/key pairs of conf.
+func LoadClientCertificates(conf Config) (*ClientCertificates, error) {
+	c := &ClientCertificates{pairs: conf.CertKeyPairs, passphrase: conf.KeyPassphrase}
+	c.stamp = c.fileStamp()
+	certs, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	c.certs = certs
+	return c, nil
+}
+
+// Get returns the current certificates.
+func (c *ClientCertificates) Get() []tls.Certificate {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.certs
+}
+
+// Watch checks the files every interval and reloads the certificates when any of them
+// changed. A failed reload, such as while the files are being replaced, is logged and
+// the current certificates are kept until the files change again. Watch does not return.
+func (c *ClientCertificates) Watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		c.reload()
+	}
+}
+
+func (c *ClientCertificates) reload() {
+	stamp := c.fileStamp()
+	if stamp == c.stamp {
+		return
+	}
+	c.stamp = stamp
+
+	certs, err := c.load()
+	if err != nil {
+		log.Printf("Could not reload the client certificates, keeping the current ones: %s", err)
+		return
+	}
+
+	previous := c.Get()
+	c.mu.Lock()
+	c.certs = certs
+	c.mu.Unlock()
+
+	for _, cert := range certs {
+		if slices.ContainsFunc(previous, func(p tls.Certificate) bool { return bytes.Equal(p.Leaf.Raw, cert.Leaf.Raw) }) {
+			continue
+		}
+		log.Printf("Reloaded client certificate %s, serial %s, expires %s",
+			cert.Leaf.Subject, fingerprint(cert.Leaf.SerialNumber.Bytes()), cert.Leaf.NotAfter.UTC().Format(time.RFC3339))
+	}
+}
+
+func (c *ClientCertificates) load() ([]tls.Certificate, error) {
+	var certs []tls.Certificate
+	for _, pair := range c.pairs {
+		cert, err := LoadClientCertificate(pair, c.passphrase)
+		if err == nil && cert.Leaf == nil {
+			cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cert/key pair %s: %w", strings.Join(pair, ", "), err)
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// fileStamp returns the modification time and size of every file of the cert/key pairs.
+// Stat follows symlinks, so files replaced by swapping a symlink are noticed too.
+func (c *ClientCertificates) fileStamp() string {
+	var b strings.Builder
+	for _, pair := range c.pairs {
+		for _, path := range pair {
+			info, err := os.Stat(path)
+			if err != nil {
+				fmt.Fprintf(&b, "%s: %s\n", path, err)
+				continue
+			}
+			fmt.Fprintf(&b, "%s: %d %d\n", path, info.ModTime().UnixNano(), info.Size())
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tidwall/resp"
+)
+
+// ErrDisconnected is returned when a command cannot be sent because the
+// connection was lost and could not be re-established.
+var ErrDisconnected = errors.New("not connected to the server")
+
+// ErrTimeout is returned by Do when the reply does not arrive within the client's Timeout.
+var ErrTimeout = errors.New("timed out waiting for the reply")
+
+// setupCommands are the commands that make up the state of a session, in the
+// order they are run when the connection is re-established.
+var setupCommands = []string{"AUTH", "SELECT", "CLIENT SETNAME"}
+
+const (
+	minReconnectBackoff = 100 * time.Millisecond
+	maxReconnectBackoff = 10 * time.Second
+
+	// resyncWait is how long to wait for the late replies to commands that timed out
+	// before re-establishing the connection.
+	resyncWait = 100 * time.Millisecond
+)
+
+// Client is a connection to a server that commands are sent on one at a time.
+// When Redial is set, the client can re-establish a lost connection and restore
+// the session's authentication, database, client name and subscriptions.
+type Client struct {
+	Addr string
+	conn net.Conn
+	r    *RespReader
+
+	// Redial opens a new connection to the server. Reconnecting is disabled when it is nil.
+	Redial func() (net.Conn, error)
+	// ReconnectAttempts is the number of times to try to reconnect before giving up.
+	ReconnectAttempts int
+	// Status is called with progress messages while reconnecting.
+	Status func(msg string)
+	// Timeout is how long Do waits for a reply. Zero waits forever.
+	Timeout time.Duration
+
+	connected bool
+	// unread counts the replies to commands that timed out, which the server may still send.
+	unread   int
+	setup    map[string][]string
+	channels []string
+	patterns []string
+}
+
+func NewClient(conn net.Conn, addr string) *Client {
+	return &Client{
+		Addr:      addr,
+		conn:      conn,
+		r:         NewRespReader(conn),
+		connected: true,
+		setup:     make(map[string][]string),
+	}
+}
+
+// Connected reports whether the client has a usable connection.
+func (c *Client) Connected() bool {
+	return c.connected
+}
+
+// Send writes the command made up of tokens to the connection.
+func (c *Client) Send(tokens []string) error {
+	if !c.connected {
+		return ErrDisconnected
+	}
+	_, err := c.conn.Write([]byte(EncodeTokens(tokens)))
+	if err != nil && isNetworkError(err) {
+		c.drop()
+	}
+	return err
+}
+
+// Receive reads the next reply from the connection.
+func (c *Client) Receive() (resp.Value, error) {
+	if !c.connected {
+		return resp.Value{}, ErrDisconnected
+	}
+	v, err := c.r.ReadValue()
+	if errors.Is(err, os.ErrDeadlineExceeded) && !c.r.Partial() {
+		// Nothing of the reply has arrived, so the connection can be used again once it has.
+		c.unread++
+		return v, ErrTimeout
+	}
+	if err != nil && isNetworkError(err) {
+		c.drop()
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return v, fmt.Errorf("%w part way through the reply, so the connection was closed", ErrTimeout)
+		}
+	}
+	return v, err
+}
+
+// Do sends a command and waits for its reply, for at most the client's Timeout.
+func (c *Client) Do(tokens ...string) (resp.Value, error) {
+	if err := c.resync(); err != nil {
+		return resp.Value{}, err
+	}
+	if err := c.Send(tokens); err != nil {
+		return resp.Value{}, err
+	}
+	if c.Timeout <= 0 {
+		return c.Receive()
+	}
+
+	c.conn.SetReadDeadline(time.Now().Add(c.Timeout))
+	v, err := c.Receive()
+	if c.connected {
+		c.conn.SetReadDeadline(time.Time{})
+	}
+	return v, err
+}
+
+// resync skips the replies to commands that timed out, so that they are not taken
+// for the replies to later commands. When they do not arrive in time, the connection
+// is re-established, or closed if the client does not reconnect.
+func (c *Client) resync() error {
+	if c.unread == 0 || !c.connected {
+		return nil
+	}
+
+	c.conn.SetReadDeadline(time.Now().Add(resyncWait))
+	for c.unread > 0 {
+		if _, err := c.r.ReadValue(); err != nil {
+			break
+		}
+		c.unread--
+		c.status("Skipped the late reply to a command that timed out.")
+	}
+	if c.unread == 0 {
+		c.conn.SetReadDeadline(time.Time{})
+		return nil
+	}
+
+	c.status("The server has not replied to a command that timed out, so the connection is re-established to keep the replies in order.")
+	if !c.CanReconnect() {
+		c.drop()
+		return ErrDisconnected
+	}
+	return c.Reconnect()
+}
+
+// Ack acknowledges a message received on a subscribed channel.
+func (c *Client) Ack() error {
+	if !c.connected {
+		return ErrDisconnected
+	}
+	_, err := c.conn.Write([]byte("+ACK\r\n\r\n"))
+	return err
+}
+
+func (c *Client) Close() error {
+	c.connected = false
+	return c.conn.Close()
+}
+
+func (c *Client) drop() {
+	c.connected = false
+	c.unread = 0
+	c.conn.Close()
+}
+
+// Track records the session state changed by a command that the server accepted,
+// so that it can be restored after reconnecting.
+func (c *Client) Track(tokens []string, reply resp.Value) {
+	if len(tokens) == 0 || reply.Type().String() == "Error" {
+		return
+	}
+
+	name := strings.ToUpper(tokens[0])
+	if len(tokens) > 1 && slices.Contains(setupCommands, name+" "+strings.ToUpper(tokens[1])) {
+		name += " " + strings.ToUpper(tokens[1])
+	}
+
+	switch name {
+	case "AUTH", "SELECT", "CLIENT SETNAME":
+		c.setup[name] = tokens
+	case "SUBSCRIBE":
+		c.channels = appendUnique(c.channels, tokens[1:]...)
+	case "PSUBSCRIBE":
+		c.patterns = appendUnique(c.patterns, tokens[1:]...)
+	case "UNSUBSCRIBE":
+		c.channels = removeOrClear(c.channels, tokens[1:])
+	case "PUNSUBSCRIBE":
+		c.patterns = removeOrClear(c.patterns, tokens[1:])
+	}
+}
+
+// Setup runs the commands that restore the session's state on the connection.
+func (c *Client) Setup() error {
+	for _, name := range setupCommands {
+		tokens, ok := c.setup[name]
+		if !ok {
+			continue
+		}
+		reply, err := c.Do(tokens...)
+		if err != nil {
+			return err
+		}
+		if reply.Type().String() == "Error" {
+			return fmt.Errorf("%s: %s", name, reply.String())
+		}
+	}
+	return nil
+}
+
+// CanReconnect reports whether the client tries to re-establish lost connections.
+func (c *Client) CanReconnect() bool {
+	return c.Redial != nil && c.ReconnectAttempts > 0
+}
+
+// Reconnect re-establishes a lost connection, retrying with exponential backoff
+// and jitter, then restores the session's state and subscriptions.
+func (c *Client) Reconnect() error {
+	if !c.CanReconnect() {
+		return ErrDisconnected
+	}
+
+	c.drop()
+
+	backoff := minReconnectBackoff
+	var err error
+	for attempt := 1; attempt <= c.ReconnectAttempts; attempt++ {
+		// Wait between half and all of the backoff so that many clients do not reconnect at once.
+		delay := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		c.status(fmt.Sprintf("Reconnecting to %s in %s (attempt %d/%d)...",
+			c.Addr, delay.Round(time.Millisecond), attempt, c.ReconnectAttempts))
+		time.Sleep(delay)
+
+		if err = c.reconnect(); err == nil {
+			c.status(fmt.Sprintf("Reconnected to %s", c.Addr))
+			return nil
+		}
+
+		backoff = min(backoff*2, maxReconnectBackoff)
+	}
+
+	c.status(fmt.Sprintf("Could not reconnect to %s: %s", c.Addr, err))
+	return ErrDisconnected
+}
+
+func (c *Client) reconnect() error {
+	conn, err := c.Redial()
+	if err != nil {
+		return err
+	}
+
+	c.conn = conn
+	c.r = NewRespReader(conn)
+	c.connected = true
+
+	if err = c.Setup(); err != nil {
+		c.drop()
+		return err
+	}
+
+	return c.resubscribe()
+}
+
+func (c *Client) resubscribe() error {
+	for _, sub := range []struct {
+		command string
+		names   []string
+	}{{"SUBSCRIBE", c.channels}, {"PSUBSCRIBE", c.patterns}} {
+		if len(sub.names) == 0 {
+			continue
+		}
+		reply, err := c.Do(append([]string{sub.command}, sub.names...)...)
+		if err != nil {
+			return err
+		}
+		if reply.Type().String() == "Error" {
+			return fmt.Errorf("%s: %s", sub.command, reply.String())
+		}
+	}
+	return nil
+}
+
+func (c *Client) status(msg string) {
+	if c.Status != nil {
+		c.Status(msg)
+	}
+}
+
+// isNetworkError reports whether err means the connection can no longer be used.
+func isNetworkError(err error) bool {
+	var netErr net.Error
+	return IsConnectionClosed(err) || errors.As(err, &netErr)
+}
+
+func appendUnique(list []string, items ...string) []string {
+	for _, item := range items {
+		if !slices.Contains(list, item) {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// removeOrClear removes items from list, or clears list when no items are given.
+func removeOrClear(list []string, items []string) []string {
+	if len(items) == 0 {
+		return nil
+	}
+	return slices.DeleteFunc(list, func(s string) bool { return slices.Contains(items, s) })
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/tidwall/resp"
+)
+
+// CommandSet is the list of commands supported by a server.
+type CommandSet struct {
+	Names       []string            // Top level command names, upper case.
+	Subcommands map[string][]string // Subcommand names by command name, upper case.
+	Syntax      map[string]string   // Argument signatures described by the server, by command name.
+}
+
+// LoadCommands returns the commands supported by the server client is connected to,
+// fetched once when the session starts. An empty set is returned if the list cannot be fetched.
+func LoadCommands(client *Client) *CommandSet {
+	set, err := FetchCommands(client)
+	if err != nil || set == nil {
+		return &CommandSet{Subcommands: make(map[string][]string), Syntax: make(map[string]string)}
+	}
+	return set
+}
+
+// FetchCommands asks the server for its commands with COMMANDS, falling back to COMMAND LIST.
+// It returns an error when neither reply lists any commands.
+func FetchCommands(client *Client) (*CommandSet, error) {
+	var lastErr error
+	for _, comm := range [][]string{{"COMMANDS"}, {"COMMAND", "LIST"}} {
+		reply, err := client.Do(comm...)
+		if err != nil {
+			return nil, err
+		}
+		if reply.Type().String() == "Error" {
+			lastErr = reply.Error()
+			continue
+		}
+		if set := parseCommandList(reply); len(set.Names) > 0 {
+			return set, nil
+		}
+	}
+	if lastErr == nil {
+		lastErr = errors.New("server returned no commands")
+	}
+	return nil, lastErr
+}
+
+// parseCommandList reads command names from the reply to COMMANDS or COMMAND LIST.
+// Each entry is either the command name, or an array describing the command in
+// which the name follows a "command" label or is the first string.
+// Subcommands are written as "CONFIG GET" or "CONFIG|GET". When a command has a
+// description that starts with its signature in parentheses, the signature is kept.
+func parseCommandList(reply resp.Value) *CommandSet {
+	set := &CommandSet{Subcommands: make(map[string][]string), Syntax: make(map[string]string)}
+
+	add := func(name string) []string {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		parts := strings.FieldsFunc(name, func(r rune) bool { return r == ' ' || r == '|' })
+		if len(parts) == 0 {
+			return nil
+		}
+		if !slices.Contains(set.Names, parts[0]) {
+			set.Names = append(set.Names, parts[0])
+		}
+		if len(parts) > 1 && !slices.Contains(set.Subcommands[parts[0]], parts[1]) {
+			set.Subcommands[parts[0]] = append(set.Subcommands[parts[0]], parts[1])
+		}
+		return parts
+	}
+
+	for _, entry := range reply.Array() {
+		if entry.Type().String() != "Array" {
+			add(entry.String())
+			continue
+		}
+
+		var parts []string
+		if name, ok := describedField(entry, "command"); ok {
+			parts = add(name)
+		} else if name, ok := firstString(entry); ok {
+			parts = add(name)
+		}
+
+		if description, ok := describedField(entry, "description"); ok && len(parts) > 0 {
+			if syntax, ok := parseSyntax(description); ok {
+				set.Syntax[strings.Join(parts, " ")] = syntax
+			}
+		}
+	}
+
+	sort.Strings(set.Names)
+	for _, subcommands := range set.Subcommands {
+		sort.Strings(subcommands)
+	}
+
+	return set
+}
+
+// describedField returns the string following the label in an array of alternating labels and values.
+func describedField(entry resp.Value, label string) (string, bool) {
+	items := entry.Array()
+	for i := 0; i < len(items)-1; i++ {
+		if items[i].Type().String() != "Array" && strings.EqualFold(items[i].String(), label) {
+			return firstString(items[i+1])
+		}
+	}
+	return "", false
+}
+
+// firstString returns v if it is a string, or the first string found in v if it is an array.
+func firstString(v resp.Value) (string, bool) {
+	if v.Type().String() != "Array" {
+		return v.String(), !v.IsNull()
+	}
+	for _, item := range v.Array() {
+		if s, ok := firstString(item); ok {
+			return s, true
+		}
+	}
+	return "", false
+}
+
+// Commands that do not take a key. For all other commands the first argument is
+// assumed to be a key unless they are listed in allKeyCommands or pairKeyCommands.
+var noKeyCommands = []string{
+	"ACL", "AUTH", "BGREWRITEAOF", "BGSAVE", "CLIENT", "COMMAND", "COMMANDS", "CONFIG", "DBSIZE",
+	"DISCARD", "ECHO", "EXEC", "FLUSHALL", "FLUSHDB", "HELLO", "INFO", "KEYS", "LASTSAVE", "MODULE",
+	"MULTI", "PING", "PSUBSCRIBE", "PUBLISH", "PUBSUB", "PUNSUBSCRIBE", "QUIT", "RANDOMKEY",
+	"REWRITEAOF", "SAVE", "SCAN", "SELECT", "SHUTDOWN", "SUBSCRIBE", "TIME", "UNSUBSCRIBE",
+}
+
+// Commands where every argument is a key.
+var allKeyCommands = []string{
+	"DEL", "EXISTS", "MGET", "SDIFF", "SINTER", "SUNION", "TOUCH", "UNLINK", "WATCH",
+}
+
+// Commands that take alternating keys and values.
+var pairKeyCommands = []string{"MSET", "MSETNX"}
+
+// isKeyPosition reports whether the argument at index arg of the command name is a key.
+// The command name itself is at index 0.
+func isKeyPosition(name string, arg int) bool {
+	name = strings.ToUpper(name)
+	switch {
+	case arg == 0, slices.Contains(noKeyCommands, name):
+		return false
+	case slices.Contains(allKeyCommands, name):
+		return true
+	case slices.Contains(pairKeyCommands, name):
+		return arg%2 == 1
+	}
+	return arg == 1
+}
+
+// Completer completes command names, subcommands and keys at the interactive prompt.
+type Completer struct {
+	client   *Client
+	commands *CommandSet
+	// The maximum number of keys sampled with SCAN for a completion.
+	keySample int
+}
+
+func NewCompleter(client *Client, commands *CommandSet) *Completer {
+	if commands == nil {
+		// Without the server's commands, only the bundled signatures are hinted.
+		commands = &CommandSet{}
+	}
+	return &Completer{client: client, commands: commands, keySample: 100}
+}
+
+// Complete returns the candidates for the word that ends at pos in line, and
+// the position the word starts at.
+func (c *Completer) Complete(line string, pos int) ([]string, int) {
+	runes := []rune(line)
+	start := pos
+	for start > 0 && runes[start-1] != ' ' {
+		start--
+	}
+	word := string(runes[start:pos])
+
+	// The words before the one being completed. Their count is the index of that word.
+	words := strings.Fields(string(runes[:start]))
+
+	var candidates []string
+	switch {
+	case len(words) == 0:
+		candidates = matchPrefix(c.commands.Names, word)
+	case len(words) == 1 && len(c.commands.Subcommands[strings.ToUpper(words[0])]) > 0:
+		candidates = matchPrefix(c.commands.Subcommands[strings.ToUpper(words[0])], word)
+	case isKeyPosition(words[0], len(words)):
+		candidates = c.sampleKeys(word)
+	}
+
+	return candidates, start
+}
+
+// matchPrefix returns the names that start with prefix, ignoring case. The
+// candidates are returned in lower case when the prefix is lower case.
+func matchPrefix(names []string, prefix string) []string {
+	lower := prefix == strings.ToLower(prefix)
+	var res []string
+	for _, name := range names {
+		if strings.HasPrefix(strings.ToUpper(name), strings.ToUpper(prefix)) {
+			if lower {
+				name = strings.ToLower(name)
+			}
+			res = append(res, name)
+		}
+	}
+	return res
+}
+
+// sampleKeys returns keys starting with prefix, sampled from the server with SCAN.
+func (c *Completer) sampleKeys(prefix string) []string {
+	if c.client == nil {
+		return nil
+	}
+
+	var keys []string
+	cursor := "0"
+	// Bound the number of round trips so completion stays responsive on large keyspaces.
+	for i := 0; i < 10 && len(keys) < c.keySample; i++ {
+		reply, err := c.client.Do("SCAN", cursor, "MATCH", escapeGlob(prefix)+"*", "COUNT", "100")
+		if err != nil || reply.Type().String() != "Array" || len(reply.Array()) != 2 {
+			break
+		}
+		cursor = reply.Array()[0].String()
+		for _, key := range reply.Array()[1].Array() {
+			if strings.HasPrefix(key.String(), prefix) && !slices.Contains(keys, key.String()) {
+				keys = append(keys, key.String())
+			}
+		}
+		if cursor == "0" {
+			break
+		}
+	}
+
+	sort.Strings(keys)
+	if len(keys) > c.keySample {
+		keys = keys[:c.keySample]
+	}
+	return keys
+}
+
+// escapeGlob escapes the glob special characters in s.
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,20 @@
+package main
+
+import "testing"
+
+func TestCompleterWithoutCommands(t *testing.T) {
+	for _, commands := range []*CommandSet{nil, {}} {
+		c := NewCompleter(nil, commands)
+		if candidates, _ := c.Complete("G", 1); len(candidates) != 0 {
+			t.Errorf("Complete: got %v, want no candidates", candidates)
+		}
+		if candidates, _ := c.Complete("CONFIG G", 8); len(candidates) != 0 {
+			t.Errorf("Complete: got %v, want no candidates", candidates)
+		}
+		// The bundled signature of SET is still hinted.
+		if hint := c.Hint("SET "); len(hint) == 0 {
+			t.Error("Hint: got no hint for SET")
+		}
+		c.Hint("G")
+	}
+}
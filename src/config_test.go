@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	filePath := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(filePath, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return filePath
+}
+
+func TestLoadConfigFileJSON(t *testing.T) {
+	filePath := writeConfigFile(t, "cli.json", `{
+  "Addr": "a\/bé",
+  "port": 7000,
+  "Timeout": "2s",
+  "ConnectTimeout": 1000000000,
+  "Profiles": {"dev": {"TLS": true}}
+}`)
+	file, err := LoadConfigFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Addr != "a/bé" || file.Port != 7000 {
+		t.Errorf("got Addr %q and Port %d, want a/bé and 7000", file.Addr, file.Port)
+	}
+	if time.Duration(file.Timeout) != 2*time.Second || time.Duration(file.ConnectTimeout) != time.Second {
+		t.Errorf("got Timeout %s and ConnectTimeout %s, want 2s and 1s", file.Timeout, file.ConnectTimeout)
+	}
+	if !file.Profiles["dev"].TLS {
+		t.Error("the dev profile does not set TLS")
+	}
+}
+
+func TestLoadConfigFileJSONErrors(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{`{"Addr": "x",}`, ":1:14: invalid character"},
+		{"{\n  \"Nope\": 1}", `:2:3: unknown key "Nope"`},
+		{`{"Addr": 5}`, ":1:10: invalid value for Addr"},
+		{`{"Port": 1.5}`, ":1:10: invalid value for Port"},
+		{`{"TLS": "true"}`, ":1:9: invalid value for TLS"},
+		{`{"Timeout": "soon"}`, `:1:13: invalid value for Timeout: invalid duration "soon"`},
+		{`{} {}`, ":1:4: unexpected data after the settings"},
+		{``, "unexpected EOF"},
+	}
+
+	for _, tt := range tests {
+		_, err := LoadConfigFile(writeConfigFile(t, "cli.json", tt.content))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want an error containing %q", tt.content, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// RunConfigInit implements the config init subcommand. It asks for the settings of a
+// connection, checks the certificate files, tries to connect and writes a commented
+// YAML config file. It returns the process exit code.
+func RunConfigInit(args []string, stdin io.Reader, stdout io.Writer) int {
+	var defaultPath string
+	if locations := ConfigFileLocations(); len(locations) > 0 {
+		defaultPath = locations[0]
+	}
+
+	fs := flag.NewFlagSet("config init", flag.ExitOnError)
+	filePath := fs.String("path", defaultPath, "File path to write the config file to.")
+	fs.Parse(args)
+
+	if len(*filePath) == 0 {
+		fmt.Fprintln(os.Stderr, "config init: --path is required")
+		return 2
+	}
+	if ext := path.Ext(*filePath); ext != ".yaml" && ext != ".yml" {
+		fmt.Fprintln(os.Stderr, "config init: --path must have a .yaml or .yml extension")
+		return 2
+	}
+
+	p := &prompter{r: bufio.NewReader(stdin), w: stdout}
+	conf, err := p.askConfig()
+	if err != nil {
+		if err != io.EOF {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return 1
+	}
+
+	fmt.Fprintf(stdout, "Connecting to %s...\n", conf.Address())
+	test := conf
+	test.ConnectTimeout = Duration(5 * time.Second)
+	test.KeyPassphrase = os.Getenv(KeyPassphraseEnv)
+	if err = test.ResolveKeyPassphrase(); err != nil {
+		fmt.Fprintln(stdout, err)
+	}
+	if conn, err := Dial(test, io.Discard); err != nil {
+		fmt.Fprintf(stdout, "Could not connect: %s\n", err)
+		if ok, err := p.confirm("Write the config file anyway?", false); err != nil || !ok {
+			return 1
+		}
+	} else {
+		conn.Close()
+		fmt.Fprintln(stdout, "Connected.")
+	}
+
+	if _, err = os.Stat(*filePath); err == nil {
+		if ok, err := p.confirm(fmt.Sprintf("%s already exists. Overwrite it?", *filePath), false); err != nil || !ok {
+			return 1
+		}
+	}
+
+	if err = os.MkdirAll(filepath.Dir(*filePath), 0700); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err = os.WriteFile(*filePath, []byte(configTemplate(conf)), 0600); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Fprintf(stdout, "Wrote %s\n", *filePath)
+	return 0
+}
+
+// prompter asks questions on w and reads the answers from r.
+type prompter struct {
+	r *bufio.Reader
+	w io.Writer
+}
+
+// ask prints question and returns the answer, or def when the answer is empty.
+func (p *prompter) ask(question string, def string) (string, error) {
+	if len(def) > 0 {
+		fmt.Fprintf(p.w, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(p.w, "%s: ", question)
+	}
+	line, err := p.r.ReadString('\n')
+	if err != nil && len(line) == 0 {
+		fmt.Fprintln(p.w)
+		return "", err
+	}
+	if answer := strings.TrimSpace(line); len(answer) > 0 {
+		return answer, nil
+	}
+	return def, nil
+}
+
+// confirm asks a yes or no question.
+func (p *prompter) confirm(question string, def bool) (bool, error) {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	for {
+		answer, err := p.ask(question+" ("+hint+")", "")
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(answer) {
+		case "":
+			return def, nil
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+	}
+}
+
+// askUntil asks question until check accepts the answer, printing each error.
+func (p *prompter) askUntil(question string, def string, check func(string) error) (string, error) {
+	for {
+		answer, err := p.ask(question, def)
+		if err != nil {
+			return "", err
+		}
+		if err = check(answer); err == nil {
+			return answer, nil
+		}
+		fmt.Fprintln(p.w, err)
+	}
+}
+
+func (p *prompter) askConfig() (Config, error) {
+	var conf Config
+
+	_, err := p.askUntil("Server address, as host:port or the path of a unix socket", "127.0.0.1:7480", func(answer string) error {
+		if strings.HasPrefix(answer, "/") {
+			conf.Socket = answer
+			return nil
+		}
+		host, port, err := net.SplitHostPort(answer)
+		if err != nil {
+			return fmt.Errorf("invalid address %q, expected host:port", answer)
+		}
+		n, err := strconv.ParseUint(port, 10, 16)
+		if err != nil || n == 0 {
+			return fmt.Errorf("invalid port %q", port)
+		}
+		conf.Addr, conf.Port = host, uint16(n)
+		return nil
+	})
+	if err != nil || len(conf.Socket) > 0 {
+		// TLS is not supported on unix sockets.
+		return conf, err
+	}
+
+	mode, err := p.askUntil("TLS mode: none, tls or mtls", "none", func(answer string) error {
+		switch answer {
+		case "none", "tls", "mtls":
+			return nil
+		}
+		return fmt.Errorf("unknown TLS mode %q, expected none, tls or mtls", answer)
+	})
+	if err != nil || mode == "none" {
+		return conf, err
+	}
+	conf.TLS = mode == "tls"
+	conf.MTLS = mode == "mtls"
+
+	for {
+		ca, err := p.askUntil("CA certificate to verify the server with (empty to finish)", "", func(answer string) error {
+			if len(answer) == 0 {
+				return nil
+			}
+			_, err := readCertificates(answer)
+			return err
+		})
+		if err != nil {
+			return conf, err
+		}
+		if len(ca) == 0 {
+			break
+		}
+		conf.ServerCAs = append(conf.ServerCAs, absPath(ca))
+	}
+
+	for conf.MTLS {
+		question := "Client certificate or .p12 bundle (empty to finish)"
+		if len(conf.CertKeyPairs) == 0 {
+			// mTLS needs at least one pair.
+			question = "Client certificate or .p12 bundle"
+		}
+		cert, err := p.askUntil(question, "", func(answer string) error {
+			if len(answer) == 0 && len(conf.CertKeyPairs) == 0 {
+				return errors.New("mTLS needs a client certificate")
+			}
+			return nil
+		})
+		if err != nil {
+			return conf, err
+		}
+		if len(cert) == 0 {
+			break
+		}
+		if IsPKCS12(cert) {
+			// A .p12 bundle holds the key too. It is checked when connecting, once the passphrase is known.
+			if _, err = os.Stat(cert); err != nil {
+				fmt.Fprintln(p.w, err)
+				continue
+			}
+			conf.CertKeyPairs = append(conf.CertKeyPairs, []string{absPath(cert)})
+			continue
+		}
+		_, err = p.askUntil("Client key for "+cert, "", func(answer string) error {
+			if _, err := LoadClientCertificate([]string{cert, answer}, ""); err != nil && !errors.Is(err, ErrPassphraseRequired) {
+				return fmt.Errorf("invalid cert/key pair: %s", err)
+			}
+			conf.CertKeyPairs = append(conf.CertKeyPairs, []string{absPath(cert), absPath(answer)})
+			return nil
+		})
+		if err != nil {
+			return conf, err
+		}
+	}
+
+	return conf, nil
+}
+
+// absPath makes filePath absolute, so the config file works from any directory.
+func absPath(filePath string) string {
+	if abs, err := filepath.Abs(filePath); err == nil {
+		return abs
+	}
+	return filePath
+}
+
+// configTemplate returns conf as a commented YAML config file.
+func configTemplate(conf Config) string {
+	var b strings.Builder
+
+	b.WriteString("# EchoVault CLI config, written by `echovault-cli config init`.\n")
+	b.WriteString("# Environment variables and flags override these settings, see `echovault-cli --print-config`.\n\n")
+
+	if len(conf.Socket) > 0 {
+		b.WriteString("# The path of the unix socket of the server.\n")
+		fmt.Fprintf(&b, "Socket: %s\n", yamlScalar(conf.Socket))
+		return b.String()
+	}
+
+	b.WriteString("# The address and port of the server.\n")
+	fmt.Fprintf(&b, "Addr: %s\n", yamlScalar(conf.Addr))
+	fmt.Fprintf(&b, "Port: %d\n\n", conf.Port)
+
+	b.WriteString("# Connect with TLS. With MTLS, the client also verifies itself to the server.\n")
+	fmt.Fprintf(&b, "TLS: %t\n", conf.TLS)
+	fmt.Fprintf(&b, "MTLS: %t\n\n", conf.MTLS)
+
+	b.WriteString("# Certificate authorities used to verify the server.\n")
+	if len(conf.ServerCAs) == 0 {
+		b.WriteString("ServerCAs: []\n\n")
+	} else {
+		b.WriteString("ServerCAs:\n")
+		for _, ca := range conf.ServerCAs {
+			fmt.Fprintf(&b, "  - %s\n", yamlScalar(ca))
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("# Cert/key pairs, or .p12 bundles, the client verifies itself with on an mTLS connection.\n")
+	b.WriteString("# Encrypted keys are decrypted with the passphrase in $" + KeyPassphraseEnv + ", --key-passphrase-file or a prompt.\n")
+	if len(conf.CertKeyPairs) == 0 {
+		b.WriteString("CertKeyPairs: []\n")
+	} else {
+		b.WriteString("CertKeyPairs:\n")
+		for _, pair := range conf.CertKeyPairs {
+			scalars := make([]string, len(pair))
+			for i, p := range pair {
+				scalars[i] = yamlScalar(p)
+			}
+			fmt.Fprintf(&b, "  - [%s]\n", strings.Join(scalars, ", "))
+		}
+	}
+
+	return b.String()
+}
+
+// yamlScalar quotes s when YAML would not read it back as the same string.
+func yamlScalar(s string) string {
+	b, err := yaml.Marshal(s)
+	if err != nil {
+		return strconv.Quote(s)
+	}
+	return strings.TrimSpace(string(b))
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Credential is an entry of the credentials file. Host and Port are patterns
+// matched with path.Match, so "*" matches any host or port.
+type Credential struct {
+	Host     string
+	Port     string
+	User     string
+	Password string
+	Cert     string
+	Key      string
+}
+
+// DefaultCredentialsFile returns the path of the credentials file in the user's home directory.
+func DefaultCredentialsFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".echovault", "credentials")
+}
+
+// LoadCredentials reads the credentials file at filePath. Each line holds a
+// host:port pattern, or the path of a unix socket, followed by key=value fields:
+//
+//	# host:port           fields
+//	127.0.0.1:7480        user=alice password=secret
+//	*.staging.internal:*  cert=/path/to/cert.pem key=/path/to/key.pem
+//	*.prod.internal:*     cert=/path/to/client.p12
+//
+// A field containing spaces is quoted as a whole, e.g. "password=my secret".
+// A missing file is not an error. The file is refused when other users can access it.
+func LoadCredentials(filePath string) ([]Credential, error) {
+	if len(filePath) == 0 {
+		return nil, nil
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	// File modes do not describe access on Windows.
+	if mode := info.Mode().Perm(); mode&0077 != 0 && runtime.GOOS != "windows" {
+		return nil, fmt.Errorf(
+			"credentials file %s has mode %04o, it must not be accessible by other users (chmod 600 %s)",
+			filePath, mode, filePath,
+		)
+	}
+
+	var credentials []Credential
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		credential, err := parseCredential(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", filePath, n, err)
+		}
+		credentials = append(credentials, credential)
+	}
+
+	return credentials, scanner.Err()
+}
+
+func parseCredential(line string) (Credential, error) {
+	tokens, err := tokenize(line)
+	if err != nil {
+		return Credential{}, err
+	}
+	fields := tokens[:0]
+	for _, token := range tokens {
+		if len(token) > 0 {
+			fields = append(fields, token)
+		}
+	}
+
+	if len(fields) == 0 {
+		return Credential{}, errors.New("expected a host:port pattern or the path of a unix socket")
+	}
+
+	var c Credential
+	if strings.HasPrefix(fields[0], "/") {
+		c.Host = fields[0]
+	} else if c.Host, c.Port, err = net.SplitHostPort(fields[0]); err != nil {
+		return c, fmt.Errorf("invalid host %q, expected host:port or the path of a unix socket", fields[0])
+	}
+	if _, err = path.Match(c.Host, ""); err != nil {
+		return c, fmt.Errorf("invalid pattern %q", c.Host)
+	}
+	if _, err = path.Match(c.Port, ""); err != nil {
+		return c, fmt.Errorf("invalid pattern %q", c.Port)
+	}
+
+	for _, field := range fields[1:] {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return c, fmt.Errorf("invalid field %q, expected key=value", field)
+		}
+		switch key {
+		case "user":
+			c.User = value
+		case "password":
+			c.Password = value
+		case "cert":
+			c.Cert = value
+		case "key":
+			c.Key = value
+		default:
+			return c, fmt.Errorf("unknown field %q, expected user, password, cert or key", key)
+		}
+	}
+
+	if (len(c.Cert) > 0) != (len(c.Key) > 0) && !(IsPKCS12(c.Cert) && len(c.Key) == 0) {
+		return c, fmt.Errorf("cert and key must be given together, unless cert is a .p12 or .pfx bundle")
+	}
+
+	return c, nil
+}
+
+// Matches reports whether the credential applies to the server described by conf.
+func (c Credential) Matches(conf Config) bool {
+	if len(conf.Socket) > 0 {
+		ok, _ := path.Match(c.Host, conf.Socket)
+		return ok && len(c.Port) == 0
+	}
+	host, port, err := net.SplitHostPort(conf.Address())
+	if err != nil {
+		return false
+	}
+	hostOk, _ := path.Match(c.Host, host)
+	portOk, _ := path.Match(c.Port, port)
+	return hostOk && portOk
+}
+
+// ApplyCredentialsFile fills in the credentials that are missing from the credentials
+// file. The file is only read when the password, or the client certificate of an mTLS
+// connection, is missing.
+func (conf *Config) ApplyCredentialsFile() error {
+	if len(conf.Password) > 0 && (!conf.MTLS || len(conf.CertKeyPairs) > 0) {
+		return nil
+	}
+	credentials, err := LoadCredentials(conf.CredentialsFile)
+	if err != nil {
+		return err
+	}
+	conf.ApplyCredentials(credentials)
+	return nil
+}
+
+// ApplyCredentials fills in the credentials that were not given on the command line
+// from the first matching entry. When a user was given, only entries for that user match.
+func (conf *Config) ApplyCredentials(credentials []Credential) {
+	for _, c := range credentials {
+		if !c.Matches(*conf) {
+			continue
+		}
+		if len(conf.Username) > 0 && len(c.User) > 0 && c.User != conf.Username {
+			continue
+		}
+
+		if len(conf.Password) == 0 && len(c.Password) > 0 {
+			if len(conf.Username) == 0 {
+				conf.Username = c.User
+			}
+			conf.Password = c.Password
+		}
+		if len(conf.CertKeyPairs) == 0 && len(c.Cert) > 0 {
+			if len(c.Key) == 0 {
+				conf.CertKeyPairs = [][]string{{c.Cert}}
+			} else {
+				conf.CertKeyPairs = [][]string{{c.Cert, c.Key}}
+			}
+			conf.MTLS = true
+		}
+		return
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import "strings"
+
+// commandSyntax is the bundled argument signature of common commands. It is used
+// for commands the server does not describe in its reply to COMMANDS.
+var commandSyntax = map[string]string{
+	"ACL CAT":        "ACL CAT [category]",
+	"ACL DELUSER":    "ACL DELUSER username [username ...]",
+	"ACL GETUSER":    "ACL GETUSER username",
+	"ACL SETUSER":    "ACL SETUSER username [rule [rule ...]]",
+	"APPEND":         "APPEND key value",
+	"AUTH":           "AUTH [username] password",
+	"CLIENT SETNAME": "CLIENT SETNAME connection-name",
+	"CONFIG GET":     "CONFIG GET parameter [parameter ...]",
+	"CONFIG SET":     "CONFIG SET parameter value [parameter value ...]",
+	"DECR":           "DECR key",
+	"DECRBY":         "DECRBY key decrement",
+	"DEL":            "DEL key [key ...]",
+	"ECHO":           "ECHO message",
+	"EXISTS":         "EXISTS key [key ...]",
+	"EXPIRE":         "EXPIRE key seconds [NX | XX | GT | LT]",
+	"GET":            "GET key",
+	"GETRANGE":       "GETRANGE key start end",
+	"HDEL":           "HDEL key field [field ...]",
+	"HGET":           "HGET key field",
+	"HGETALL":        "HGETALL key",
+	"HINCRBY":        "HINCRBY key field increment",
+	"HSET":           "HSET key field value [field value ...]",
+	"INCR":           "INCR key",
+	"INCRBY":         "INCRBY key increment",
+	"KEYS":           "KEYS pattern",
+	"LINDEX":         "LINDEX key index",
+	"LPOP":           "LPOP key [count]",
+	"LPUSH":          "LPUSH key element [element ...]",
+	"LRANGE":         "LRANGE key start stop",
+	"MGET":           "MGET key [key ...]",
+	"MSET":           "MSET key value [key value ...]",
+	"PEXPIRE":        "PEXPIRE key milliseconds [NX | XX | GT | LT]",
+	"PING":           "PING [message]",
+	"PSUBSCRIBE":     "PSUBSCRIBE pattern [pattern ...]",
+	"PUBLISH":        "PUBLISH channel message",
+	"PUNSUBSCRIBE":   "PUNSUBSCRIBE [pattern [pattern ...]]",
+	"RPOP":           "RPOP key [count]",
+	"RPUSH":          "RPUSH key element [element ...]",
+	"SADD":           "SADD key member [member ...]",
+	"SCAN":           "SCAN cursor [MATCH pattern] [COUNT count]",
+	"SELECT":         "SELECT index",
+	"SET":            "SET key value [NX | XX] [GET] [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds]",
+	"SETRANGE":       "SETRANGE key offset value",
+	"SISMEMBER":      "SISMEMBER key member",
+	"SMEMBERS":       "SMEMBERS key",
+	"SREM":           "SREM key member [member ...]",
+	"STRLEN":         "STRLEN key",
+	"SUBSCRIBE":      "SUBSCRIBE channel [channel ...]",
+	"TTL":            "TTL key",
+	"UNSUBSCRIBE":    "UNSUBSCRIBE [channel [channel ...]]",
+	"XADD":           "XADD key [NOMKSTREAM] [MAXLEN | MINID [= | ~] threshold] <* | id> field value [field value ...]",
+	"XRANGE":         "XRANGE key start end [COUNT count]",
+	"ZADD":           "ZADD key [NX | XX] [GT | LT] [CH] [INCR] score member [score member ...]",
+	"ZCARD":          "ZCARD key",
+	"ZRANGE":         "ZRANGE key start stop [BYSCORE | BYLEX] [REV] [LIMIT offset count] [WITHSCORES]",
+	"ZREM":           "ZREM key member [member ...]",
+	"ZSCORE":         "ZSCORE key member",
+}
+
+// parseSyntax reads the argument signature from a command description of the
+// form "(SET key value [NX | XX]) Set the value of a key.".
+func parseSyntax(description string) (string, bool) {
+	description = strings.TrimSpace(description)
+	if !strings.HasPrefix(description, "(") {
+		return "", false
+	}
+	depth := 0
+	for i, r := range description {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return strings.TrimSpace(description[1:i]), true
+			}
+		}
+	}
+	return "", false
+}
+
+// splitSyntax splits an argument signature into its parameters, keeping
+// bracketed groups such as "[EX seconds | PX milliseconds]" together.
+func splitSyntax(syntax string) []string {
+	var params []string
+	var current strings.Builder
+	depth := 0
+	for _, r := range syntax {
+		switch {
+		case r == '[' || r == '<' || r == '(':
+			depth++
+		case r == ']' || r == '>' || r == ')':
+			depth--
+		case r == ' ' && depth == 0:
+			if current.Len() > 0 {
+				params = append(params, current.String())
+				current.Reset()
+			}
+			continue
+		}
+		current.WriteRune(r)
+	}
+	if current.Len() > 0 {
+		params = append(params, current.String())
+	}
+	return params
+}
+
+// Hint returns the parameters of the command in line that have not been typed yet.
+// The server's description of the command is preferred over the bundled signature.
+func (c *Completer) Hint(line string) string {
+	words := strings.Fields(line)
+	if len(words) == 0 {
+		return ""
+	}
+
+	syntax, nameWords := c.lookupSyntax(words)
+	if len(syntax) == 0 {
+		return ""
+	}
+
+	params := splitSyntax(syntax)
+	if len(params) < nameWords {
+		return ""
+	}
+	params = params[nameWords:]
+
+	typed := len(words) - nameWords
+	if typed >= len(params) {
+		return ""
+	}
+	if strings.HasSuffix(line, " ") {
+		return strings.Join(params[typed:], " ")
+	}
+	// The last word is still being typed, so the hint starts after a space.
+	return " " + strings.Join(params[typed:], " ")
+}
+
+// lookupSyntax returns the signature of the command at the start of words and
+// the number of words that make up its name.
+func (c *Completer) lookupSyntax(words []string) (string, int) {
+	name := strings.ToUpper(words[0])
+	if len(words) > 1 {
+		sub := name + " " + strings.ToUpper(words[1])
+		if syntax, ok := c.commands.Syntax[sub]; ok {
+			return syntax, 2
+		}
+		if syntax, ok := commandSyntax[sub]; ok {
+			return syntax, 2
+		}
+	}
+	if syntax, ok := c.commands.Syntax[name]; ok {
+		return syntax, 1
+	}
+	if syntax, ok := commandSyntax[name]; ok {
+		return syntax, 1
+	}
+	return "", 0
+}
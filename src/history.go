@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultHistoryFile returns the path of the history file in the user's home directory.
+func DefaultHistoryFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".echovault_cli_history")
+}
+
+// History holds the lines entered at the interactive prompt, oldest first.
+// When a path is set, the history is persisted to that file.
+type History struct {
+	entries []string
+	size    int
+	path    string
+}
+
+// LoadHistory reads the history file at path, keeping at most size entries.
+// A missing file is not an error. An empty path keeps the history in memory only.
+func LoadHistory(path string, size int) (*History, error) {
+	h := &History{size: size, path: path}
+	if len(path) == 0 {
+		return h, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return h, nil
+		}
+		return h, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); len(line) > 0 {
+			h.entries = append(h.entries, line)
+		}
+	}
+	h.trim()
+
+	return h, scanner.Err()
+}
+
+// Entries returns the history, oldest first.
+func (h *History) Entries() []string {
+	return h.entries
+}
+
+// Add appends line to the history and saves the history file. Lines that repeat
+// the previous entry are not added. Lines containing credentials are kept for
+// the current session but never written to the file.
+func (h *History) Add(line string) error {
+	line = strings.TrimSpace(line)
+	if len(line) == 0 || (len(h.entries) > 0 && h.entries[len(h.entries)-1] == line) {
+		return nil
+	}
+
+	h.entries = append(h.entries, line)
+	h.trim()
+
+	return h.save()
+}
+
+func (h *History) trim() {
+	if h.size > 0 && len(h.entries) > h.size {
+		h.entries = h.entries[len(h.entries)-h.size:]
+	}
+}
+
+func (h *History) save() error {
+	if len(h.path) == 0 {
+		return nil
+	}
+
+	f, err := os.OpenFile(h.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	for _, line := range h.entries {
+		if IsSensitiveCommand(line) {
+			continue
+		}
+		w.WriteString(line)
+		w.WriteByte('\n')
+	}
+
+	if err = w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// IsSensitiveCommand reports whether the command line may contain a password,
+// e.g. AUTH, HELLO ... AUTH, ACL SETUSER with password rules, or CONFIG SET requirepass.
+func IsSensitiveCommand(line string) bool {
+	tokens, err := tokenize(line)
+	if err != nil {
+		// Err on the side of caution with lines that cannot be parsed.
+		tokens = strings.Fields(line)
+	}
+	return isSensitiveTokens(tokens)
+}
+
+// isSensitiveTokens is IsSensitiveCommand for a command that is already split into tokens.
+func isSensitiveTokens(tokens []string) bool {
+	for i, token := range tokens {
+		upper := strings.ToUpper(token)
+		if upper == "AUTH" || strings.Contains(upper, "PASS") || strings.Contains(upper, "SECRET") {
+			return true
+		}
+		if i > 0 && (strings.HasPrefix(token, ">") || strings.HasPrefix(token, "#")) &&
+			strings.EqualFold(tokens[0], "ACL") {
+			return true
+		}
+	}
+
+	return false
+}
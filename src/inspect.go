@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// RunTLSInspect implements the tls inspect subcommand. It connects to the server and
+// prints its certificate chain, whether the chain verifies and against which CA, and
+// the negotiated TLS version and cipher suite. It returns the process exit code, which
+// is 1 when the chain does not verify or a certificate expires within --warn-days.
+func RunTLSInspect(conf Config, args []string, stdout io.Writer) int {
+	fs := flag.NewFlagSet("tls inspect", flag.ExitOnError)
+	warnDays := fs.Int("warn-days", 30, "Warn about certificates that expire within this many days.")
+	fs.Parse(args)
+
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "tls inspect: unexpected arguments %s\n", strings.Join(fs.Args(), " "))
+		return 2
+	}
+	if len(conf.Socket) > 0 {
+		fmt.Fprintln(os.Stderr, "tls inspect: TLS is not supported on unix socket connections")
+		return 2
+	}
+
+	// The server is inspected over TLS even when --tls is not set.
+	conf.TLS = true
+	if err := conf.ApplyCredentialsFile(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := conf.ResolveKeyPassphrase(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	config, err := loadTLSConfig(conf)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	// The chain is verified below, so that it can be printed when verification fails.
+	config.InsecureSkipVerify = true
+	config.VerifyConnection = nil
+
+	serverName := config.ServerName
+	if len(serverName) == 0 {
+		serverName, _, _ = net.SplitHostPort(conf.Address())
+	}
+
+	dialer := net.Dialer{Timeout: time.Duration(conf.ConnectTimeout)}
+	conn, err := tlsTransport{address: conf.Address(), config: config}.Dial(&dialer)
+	var handshakeErr *HandshakeError
+	if errors.As(err, &handshakeErr) {
+		fmt.Fprintf(os.Stderr, "Handshake failed with %s: %s\n", conf.Address(), handshakeErr.Err)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	state := conn.(*tls.Conn).ConnectionState()
+	conn.Close()
+
+	fmt.Fprintf(stdout, "Server:       %s\n", conf.Address())
+	fmt.Fprintf(stdout, "Server name:  %s\n", serverName)
+	fmt.Fprintf(stdout, "Version:      %s\n", tls.VersionName(state.Version))
+	fmt.Fprintf(stdout, "Cipher suite: %s\n", tls.CipherSuiteName(state.CipherSuite))
+
+	now := time.Now()
+	for i, cert := range state.PeerCertificates {
+		role := "intermediate"
+		if i == 0 {
+			role = "leaf"
+		} else if bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+			role = "root"
+		}
+		fmt.Fprintf(stdout, "\nCertificate %d (%s)\n", i, role)
+		printCertificate(stdout, cert, now)
+	}
+
+	code := 0
+	chains, err := verifyPeerCertificates(state.PeerCertificates, config.RootCAs, serverName, now)
+	fmt.Fprintln(stdout)
+	if err != nil {
+		code = 1
+		fmt.Fprintf(stdout, "Verification: FAILED\n  %s\n", err)
+		if hint := verifyHint(err); len(hint) > 0 {
+			fmt.Fprintf(stdout, "  %s\n", hint)
+		}
+	} else {
+		chain := chains[0]
+		root := chain[len(chain)-1]
+		fmt.Fprintln(stdout, "Verification: OK")
+		fmt.Fprintf(stdout, "  Verified by: %s\n", root.Subject)
+		fmt.Fprintf(stdout, "  From:        %s\n", caSource(conf, root))
+		if !bytes.Equal(state.PeerCertificates[len(state.PeerCertificates)-1].Raw, root.Raw) {
+			// The root CA is not sent by the server, so it was not printed above.
+			fmt.Fprintln(stdout, "\nRoot CA")
+			printCertificate(stdout, root, now)
+		}
+	}
+	if conf.Insecure {
+		fmt.Fprintln(stdout, "  --insecure is set, so connections skip this verification.")
+	}
+
+	if len(conf.TLSPins) > 0 {
+		pins, err := parsePins(conf.TLSPins)
+		if err == nil {
+			err = verifyPins(state.PeerCertificates, pins)
+			for _, chain := range chains {
+				if verifyPins(chain, pins) == nil {
+					err = nil
+				}
+			}
+		}
+		if err != nil {
+			code = 1
+			fmt.Fprintf(stdout, "Pins: FAILED\n  %s\n", err)
+		} else {
+			fmt.Fprintln(stdout, "Pins: OK")
+		}
+	}
+
+	// Warn about the certificates that will expire soon, including a root CA from the trust store.
+	certs := state.PeerCertificates
+	if len(chains) > 0 {
+		certs = chains[0]
+	}
+	warnBefore := now.AddDate(0, 0, *warnDays)
+	for _, cert := range certs {
+		if cert.NotAfter.Before(warnBefore) {
+			code = 1
+			fmt.Fprintf(os.Stderr, "WARNING: %s %s\n", cert.Subject, expiry(cert, now))
+		}
+	}
+
+	return code
+}
+
+// verifyPeerCertificates verifies the chain the server presented the way crypto/tls does.
+func verifyPeerCertificates(certs []*x509.Certificate, roots *x509.CertPool, serverName string, now time.Time) ([][]*x509.Certificate, error) {
+	if len(certs) == 0 {
+		return nil, errors.New("the server presented no certificates")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	return certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		DNSName:       serverName,
+		CurrentTime:   now,
+	})
+}
+
+// verifyHint suggests how to fix a verification error.
+func verifyHint(err error) string {
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	switch {
+	case errors.As(err, &unknownAuthority):
+		return "The chain does not lead to a trusted CA. Add the CA that issued it with --server-ca or --ca-dir."
+	case errors.As(err, &hostname):
+		return "The certificate is not valid for the server name. Use --tls-server-name with one of its SANs."
+	case errors.As(err, &invalid) && invalid.Reason == x509.Expired:
+		return "A certificate in the chain has expired or is not valid yet. Check the dates above and the local clock."
+	}
+	return ""
+}
+
+// caSource returns where the root CA the chain verified against was configured.
+func caSource(conf Config, root *x509.Certificate) string {
+	if files, err := serverCAFiles(conf); err == nil {
+		for _, file := range files {
+			certs, err := readCertificates(file)
+			if err != nil {
+				continue
+			}
+			for _, cert := range certs {
+				if bytes.Equal(cert.Raw, root.Raw) {
+					return file
+				}
+			}
+		}
+	}
+	return "the system trust store"
+}
+
+func printCertificate(w io.Writer, cert *x509.Certificate, now time.Time) {
+	fmt.Fprintf(w, "  Subject:     %s\n", cert.Subject)
+	fmt.Fprintf(w, "  Issuer:      %s\n", cert.Issuer)
+	fmt.Fprintf(w, "  SANs:        %s\n", subjectAltNames(cert))
+	fmt.Fprintf(w, "  Not before:  %s\n", cert.NotBefore.UTC().Format(time.RFC3339))
+	fmt.Fprintf(w, "  Not after:   %s (%s)\n", cert.NotAfter.UTC().Format(time.RFC3339), expiry(cert, now))
+	fmt.Fprintf(w, "  Serial:      %s\n", fingerprint(cert.SerialNumber.Bytes()))
+	fmt.Fprintf(w, "  Key:         %s\n", keyType(cert))
+	fmt.Fprintf(w, "  Signature:   %s\n", cert.SignatureAlgorithm)
+	fmt.Fprintf(w, "  SHA-256:     %s\n", fingerprint(sha256Sum(cert.Raw)))
+	fmt.Fprintf(w, "  SHA-1:       %s\n", fingerprint(sha1Sum(cert.Raw)))
+	fmt.Fprintf(w, "  Pin:         %s\n", SPKIPin(cert))
+}
+
+func subjectAltNames(cert *x509.Certificate) string {
+	var names []string
+	for _, name := range cert.DNSNames {
+		names = append(names, "DNS:"+name)
+	}
+	for _, ip := range cert.IPAddresses {
+		names = append(names, "IP:"+ip.String())
+	}
+	for _, email := range cert.EmailAddresses {
+		names = append(names, "email:"+email)
+	}
+	for _, uri := range cert.URIs {
+		names = append(names, "URI:"+uri.String())
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
+
+// expiry describes when cert expires relative to now.
+func expiry(cert *x509.Certificate, now time.Time) string {
+	if now.Before(cert.NotBefore) {
+		return "not valid yet"
+	}
+	days := int(cert.NotAfter.Sub(now).Hours() / 24)
+	switch {
+	case cert.NotAfter.Before(now):
+		return fmt.Sprintf("expired %d days ago", -days)
+	case days == 1:
+		return "expires in 1 day"
+	}
+	return fmt.Sprintf("expires in %d days", days)
+}
+
+func keyType(cert *x509.Certificate) string {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d bits", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA " + key.Curve.Params().Name
+	case ed25519.PublicKey:
+		return "Ed25519"
+	}
+	return cert.PublicKeyAlgorithm.String()
+}
+
+// fingerprint formats b as colon separated hex bytes.
+func fingerprint(b []byte) string {
+	parts := make([]string, len(b))
+	for i, c := range b {
+		parts[i] = fmt.Sprintf("%02X", c)
+	}
+	return strings.Join(parts, ":")
+}
+
+func sha256Sum(b []byte) []byte {
+	sum := sha256.Sum256(b)
+	return sum[:]
+}
+
+func sha1Sum(b []byte) []byte {
+	sum := sha1.Sum(b)
+	return sum[:]
+}
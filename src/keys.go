@@ -0,0 +1,333 @@
+package main
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/youmark/pkcs8"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// KeyPassphraseEnv is the environment variable the passphrase of encrypted client keys is read from.
+const KeyPassphraseEnv = "ECHOVAULT_KEY_PASSPHRASE"
+
+// ErrPassphraseRequired is returned when a client key is encrypted and no passphrase was given.
+var ErrPassphraseRequired = errors.New("the client key is encrypted, set " + KeyPassphraseEnv + " or --key-passphrase-file")
+
+// errIncorrectPassphrase is returned when an encrypted key does not decrypt with the passphrase.
+var errIncorrectPassphrase = errors.New("incorrect passphrase")
+
+// IsPKCS12 reports whether path names a PKCS#12 bundle, by its extension.
+func IsPKCS12(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".p12" || ext == ".pfx"
+}
+
+// checkCertKeyPair checks that pair is a cert and a key file path, or the path of a PKCS#12 bundle.
+func checkCertKeyPair(pair []string) error {
+	if len(pair) == 1 && IsPKCS12(pair[0]) {
+		return nil
+	}
+	if len(pair) != 2 {
+		return errors.New("certKeyPair must be 2 comma separated file paths, or a .p12 or .pfx file path")
+	}
+	return nil
+}
+
+// LoadClientCertificate loads a client identity from a cert/key pair of PEM files, or
+// from a single PKCS#12 bundle. Encrypted keys are decrypted with passphrase.
+func LoadClientCertificate(pair []string, passphrase string) (tls.Certificate, error) {
+	if err := checkCertKeyPair(pair); err != nil {
+		return tls.Certificate{}, err
+	}
+	if len(pair) == 1 {
+		b, err := os.ReadFile(pair[0])
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+		cert, err := decodePKCS12(b, passphrase)
+		if err != nil {
+			return cert, fmt.Errorf("%s: %w", pair[0], err)
+		}
+		return cert, nil
+	}
+
+	certPEM, err := os.ReadFile(pair[0])
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	keyPEM, err := os.ReadFile(pair[1])
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if keyPEM, err = decryptKeyPEM(keyPEM, passphrase); err != nil {
+		return tls.Certificate{}, fmt.Errorf("%s: %w", pair[1], err)
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// ResolveKeyPassphrase reads the passphrase of encrypted client keys from
+// KeyPassphraseFile, or prompts for it on the terminal, so that it is only
+// asked for once rather than on every reconnect.
+func (conf *Config) ResolveKeyPassphrase() error {
+	if len(conf.KeyPassphrase) > 0 || !conf.MTLS && !conf.TLS {
+		return nil
+	}
+
+	if len(conf.KeyPassphraseFile) > 0 {
+		b, err := os.ReadFile(conf.KeyPassphraseFile)
+		if err != nil {
+			return err
+		}
+		conf.KeyPassphrase = strings.TrimRight(string(b), "\r\n")
+		return nil
+	}
+
+	for _, pair := range conf.CertKeyPairs {
+		if _, err := LoadClientCertificate(pair, ""); errors.Is(err, ErrPassphraseRequired) {
+			passphrase, err := PromptSecret("Passphrase for " + pair[len(pair)-1] + ": ")
+			if err != nil {
+				return fmt.Errorf("%s: %w", pair[len(pair)-1], ErrPassphraseRequired)
+			}
+			conf.KeyPassphrase = passphrase
+			return nil
+		}
+	}
+	return nil
+}
+
+// decryptKeyPEM returns keyPEM with its encrypted private key decrypted. PKCS#8
+// "ENCRYPTED PRIVATE KEY" blocks and legacy OpenSSL encrypted PEM blocks are supported.
+func decryptKeyPEM(keyPEM []byte, passphrase string) ([]byte, error) {
+	var out []byte
+	for {
+		var block *pem.Block
+		if block, keyPEM = pem.Decode(keyPEM); block == nil {
+			break
+		}
+
+		switch {
+		case block.Type == "ENCRYPTED PRIVATE KEY":
+			if len(passphrase) == 0 {
+				return nil, ErrPassphraseRequired
+			}
+			der, err := decryptPKCS8(block.Bytes, passphrase)
+			if err != nil {
+				return nil, err
+			}
+			block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+		case x509.IsEncryptedPEMBlock(block):
+			// Legacy "Proc-Type: 4,ENCRYPTED" keys, as written by openssl rsa -aes256.
+			if len(passphrase) == 0 {
+				return nil, ErrPassphraseRequired
+			}
+			der, err := x509.DecryptPEMBlock(block, []byte(passphrase))
+			if err != nil {
+				return nil, errIncorrectPassphrase
+			}
+			block = &pem.Block{Type: block.Type, Bytes: der}
+		}
+		out = append(out, pem.EncodeToMemory(block)...)
+	}
+	return out, nil
+}
+
+// decryptPKCS8 decrypts a DER encoded EncryptedPrivateKeyInfo and returns the PrivateKeyInfo.
+func decryptPKCS8(der []byte, passphrase string) (key []byte, err error) {
+	// pkcs8 does not check the length of the encrypted data before decrypting it,
+	// and panics when it is not a whole number of blocks.
+	defer func() {
+		if recover() != nil {
+			key, err = nil, errors.New("invalid encrypted private key")
+		}
+	}()
+
+	priv, err := pkcs8.ParsePKCS8PrivateKey(der, []byte(passphrase))
+	if err != nil {
+		if err.Error() == "pkcs8: incorrect password" {
+			return nil, errIncorrectPassphrase
+		}
+		return nil, err
+	}
+	return x509.MarshalPKCS8PrivateKey(priv)
+}
+
+// decodePKCS12 reads the private key and certificates of a PKCS#12 bundle. The
+// certificate that matches the key comes first, followed by the rest of the chain.
+func decodePKCS12(b []byte, passphrase string) (tls.Certificate, error) {
+	var cert tls.Certificate
+
+	der, err := berToDER(b)
+	if err != nil {
+		return cert, fmt.Errorf("invalid PKCS#12 bundle: %s", err)
+	}
+
+	// Bundles without a MAC only fail on the padding of the decrypted data.
+	wrongPassphrase := func(err error) bool {
+		return errors.Is(err, pkcs12.ErrIncorrectPassword) || errors.Is(err, pkcs12.ErrDecryption)
+	}
+
+	key, leaf, chain, err := pkcs12.DecodeChain(der, passphrase)
+	if wrongPassphrase(err) && len(passphrase) > 0 {
+		// A bundle exported without a password still opens when a passphrase is set for other keys.
+		if key, leaf, chain, err = pkcs12.DecodeChain(der, ""); wrongPassphrase(err) {
+			return cert, errIncorrectPassphrase
+		}
+	}
+	switch {
+	case wrongPassphrase(err):
+		return cert, ErrPassphraseRequired
+	case err != nil:
+		return cert, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return cert, errors.New("unsupported private key type in the PKCS#12 bundle")
+	}
+
+	cert.PrivateKey = key
+	for _, c := range append([]*x509.Certificate{leaf}, chain...) {
+		if pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool }); ok && pub.Equal(c.PublicKey) && cert.Leaf == nil {
+			cert.Certificate = append([][]byte{c.Raw}, cert.Certificate...)
+			cert.Leaf = c
+		} else {
+			cert.Certificate = append(cert.Certificate, c.Raw)
+		}
+	}
+	if cert.Leaf == nil {
+		return cert, errors.New("no certificate in the PKCS#12 bundle matches its private key")
+	}
+	return cert, nil
+}
+
+// berToDER re-encodes a BER encoded value as DER, the only encoding the PKCS#12
+// decoder reads. Bundles written by Java's keytool and by Windows use indefinite
+// lengths and split OCTET STRINGs into constructed chunks; both are rewritten in
+// their definite, primitive form. DER input is returned unchanged.
+func berToDER(b []byte) ([]byte, error) {
+	tag, content, rest, err := readBER(b, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("trailing data after the bundle")
+	}
+	return appendDER(nil, tag, content), nil
+}
+
+// The deepest nesting of BER values read, which bounds the recursion on hostile input.
+const maxBERDepth = 64
+
+// readBER reads the BER value at the start of b. It returns its tag bytes, its
+// content converted to DER, and the bytes that follow the value.
+func readBER(b []byte, depth int) (tag, content, rest []byte, err error) {
+	if depth > maxBERDepth {
+		return nil, nil, nil, errors.New("values nested too deeply")
+	}
+	if len(b) < 2 {
+		return nil, nil, nil, errors.New("truncated value")
+	}
+
+	n := 1
+	if b[0]&0x1f == 0x1f {
+		// A high tag number continues while the top bit of each byte is set.
+		for n < len(b) && b[n]&0x80 != 0 {
+			n++
+		}
+		n++
+	}
+	if n >= len(b) {
+		return nil, nil, nil, errors.New("truncated value")
+	}
+	tag, b = b[:n], b[n:]
+	constructed := tag[0]&0x20 != 0
+
+	length, indefinite := 0, b[0] == 0x80
+	switch {
+	case indefinite:
+		if !constructed {
+			return nil, nil, nil, errors.New("indefinite length on a primitive value")
+		}
+		b = b[1:]
+	case b[0] < 0x80:
+		length, b = int(b[0]), b[1:]
+	default:
+		size := int(b[0] & 0x7f)
+		if size > 4 || size >= len(b) {
+			return nil, nil, nil, errors.New("invalid length")
+		}
+		for _, c := range b[1 : 1+size] {
+			length = length<<8 | int(c)
+		}
+		b = b[1+size:]
+	}
+	if !indefinite {
+		if length < 0 || length > len(b) {
+			return nil, nil, nil, errors.New("truncated value")
+		}
+		b, rest = b[:length], b[length:]
+	}
+
+	if !constructed {
+		return tag, b, rest, nil
+	}
+
+	// A constructed OCTET STRING holds its value in chunks, which DER joins.
+	octetString := len(tag) == 1 && tag[0] == 0x24
+	if octetString {
+		tag = []byte{0x04}
+	}
+
+	for {
+		if indefinite {
+			if len(b) < 2 {
+				return nil, nil, nil, errors.New("missing end of contents")
+			}
+			if b[0] == 0 && b[1] == 0 {
+				rest = b[2:]
+				break
+			}
+		} else if len(b) == 0 {
+			break
+		}
+
+		childTag, childContent, childRest, err := readBER(b, depth+1)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		b = childRest
+		if octetString {
+			if childTag[0] != 0x04 {
+				return nil, nil, nil, errors.New("invalid chunk in a constructed OCTET STRING")
+			}
+			content = append(content, childContent...)
+		} else {
+			content = appendDER(content, childTag, childContent)
+		}
+	}
+	return tag, content, rest, nil
+}
+
+// appendDER appends the value with tag and content to dst, with its length in the shortest form.
+func appendDER(dst, tag, content []byte) []byte {
+	dst = append(dst, tag...)
+	if len(content) < 0x80 {
+		dst = append(dst, byte(len(content)))
+	} else {
+		var length []byte
+		for n := len(content); n > 0; n >>= 8 {
+			length = append([]byte{byte(n)}, length...)
+		}
+		dst = append(dst, 0x80|byte(len(length)))
+		dst = append(dst, length...)
+	}
+	return append(dst, content...)
+}
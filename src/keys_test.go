@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/tls"
+	"encoding/asn1"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The files in testdata hold client1 from openssl/client, encrypted with the
+// passphrase below. They were written with:
+//
+//	openssl pkcs8 -topk8 -in client1.key -v2 aes-256-cbc -v2prf hmacWithSHA1 -out client1-aes256-sha1.key
+//	openssl pkcs8 -topk8 -in client1.key -v2 aes-128-cbc -v2prf hmacWithSHA256 -out client1-aes128-sha256.key
+//	openssl rsa -in client1.key -traditional -aes256 -out client1-legacy.key
+//	openssl pkcs12 -export -in client1.crt -inkey client1.key -out client1-aes.p12
+//	openssl pkcs12 -export -in client1.crt -inkey client1.key -certpbe PBE-SHA1-3DES -keypbe PBE-SHA1-3DES -macalg sha1 -out client1-3des.p12
+//	openssl pkcs12 -export -in client1.crt -inkey client1.key -passout pass: -out client1-nopass.p12
+const testPassphrase = "s3cret"
+
+const (
+	client1Cert = "../openssl/client/client1.crt"
+	client1Key  = "../openssl/client/client1.key"
+)
+
+type keyFixture struct {
+	name string
+	pair []string
+}
+
+var encryptedClient1 = []keyFixture{
+	{"PBES2 AES-256 HMAC-SHA1", []string{client1Cert, "testdata/client1-aes256-sha1.key"}},
+	{"PBES2 AES-128 HMAC-SHA256", []string{client1Cert, "testdata/client1-aes128-sha256.key"}},
+	{"legacy PEM", []string{client1Cert, "testdata/client1-legacy.key"}},
+	{"PKCS#12 AES", []string{"testdata/client1-aes.p12"}},
+	{"PKCS#12 3DES", []string{"testdata/client1-3des.p12"}},
+}
+
+func TestLoadClientCertificate(t *testing.T) {
+	want, err := tls.LoadX509KeyPair(client1Cert, client1Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := append(encryptedClient1, keyFixture{"PKCS#12 without a password", []string{"testdata/client1-nopass.p12"}})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadClientCertificate(tt.pair, testPassphrase)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Certificate) == 0 || !bytes.Equal(got.Certificate[0], want.Certificate[0]) {
+				t.Error("the certificate does not match client1.crt")
+			}
+			key, ok := got.PrivateKey.(*rsa.PrivateKey)
+			if !ok || !key.Equal(want.PrivateKey) {
+				t.Error("the private key does not match client1.key")
+			}
+		})
+	}
+}
+
+func TestLoadClientCertificateWithoutPassphrase(t *testing.T) {
+	if _, err := LoadClientCertificate([]string{"testdata/client1-nopass.p12"}, ""); err != nil {
+		t.Errorf("PKCS#12 without a password: %s", err)
+	}
+
+	for _, tt := range encryptedClient1 {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadClientCertificate(tt.pair, "")
+			if !errors.Is(err, ErrPassphraseRequired) {
+				t.Errorf("got %v, want ErrPassphraseRequired", err)
+			}
+		})
+	}
+}
+
+func TestLoadClientCertificateWrongPassphrase(t *testing.T) {
+	for _, tt := range encryptedClient1 {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadClientCertificate(tt.pair, "wrong")
+			if !errors.Is(err, errIncorrectPassphrase) {
+				t.Errorf("got %v, want errIncorrectPassphrase", err)
+			}
+		})
+	}
+}
+
+func TestLoadClientCertificateBER(t *testing.T) {
+	want, err := tls.LoadX509KeyPair(client1Cert, client1Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"client1-aes.p12", "client1-3des.p12", "client1-nopass.p12"} {
+		t.Run(name, func(t *testing.T) {
+			der, err := os.ReadFile(filepath.Join("testdata", name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(t.TempDir(), name)
+			if err := os.WriteFile(path, toBER(t, der), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := LoadClientCertificate([]string{path}, testPassphrase)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Certificate) == 0 || !bytes.Equal(got.Certificate[0], want.Certificate[0]) {
+				t.Error("the certificate does not match client1.crt")
+			}
+		})
+	}
+}
+
+func TestBERToDER(t *testing.T) {
+	der, err := os.ReadFile("testdata/client1-aes.p12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := berToDER(der); err != nil || !bytes.Equal(got, der) {
+		t.Errorf("DER input was not returned unchanged: %v", err)
+	}
+	if got, err := berToDER(toBER(t, der)); err != nil || !bytes.Equal(got, der) {
+		t.Errorf("BER input was not converted back to the original DER: %v", err)
+	}
+
+	invalid := map[string][]byte{
+		"empty":                   {},
+		"truncated":               {0x30, 0x05, 0x02, 0x01},
+		"missing end of contents": {0x30, 0x80, 0x02, 0x01, 0x01},
+		"indefinite primitive":    {0x04, 0x80, 0x00, 0x00},
+		"oversized length":        {0x04, 0x85, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"trailing data":           {0x05, 0x00, 0x05},
+		"bad OCTET STRING chunk":  {0x24, 0x80, 0x02, 0x01, 0x01, 0x00, 0x00},
+		"nested too deeply":       bytes.Repeat([]byte{0x30, 0x80}, 1000),
+	}
+	for name, b := range invalid {
+		if _, err := berToDER(b); err == nil {
+			t.Errorf("%s: got no error", name)
+		}
+	}
+}
+
+// toBER re-encodes a DER value the way Java's keytool and Windows write PKCS#12
+// bundles: constructed values get indefinite lengths, and long OCTET STRINGs are
+// split into constructed chunks.
+func toBER(t *testing.T, der []byte) []byte {
+	t.Helper()
+	var v asn1.RawValue
+	if rest, err := asn1.Unmarshal(der, &v); err != nil || len(rest) > 0 {
+		t.Fatalf("invalid DER: %v", err)
+	}
+
+	tag := byte(v.Class<<6 | v.Tag)
+	switch {
+	case v.IsCompound:
+		out := []byte{tag | 0x20, 0x80}
+		for b := v.Bytes; len(b) > 0; {
+			var child asn1.RawValue
+			rest, err := asn1.Unmarshal(b, &child)
+			if err != nil {
+				t.Fatalf("invalid DER: %v", err)
+			}
+			out = append(out, toBER(t, b[:len(b)-len(rest)])...)
+			b = rest
+		}
+		return append(out, 0, 0)
+	case v.Class == asn1.ClassUniversal && v.Tag == asn1.TagOctetString && len(v.Bytes) > 32:
+		out := []byte{0x24, 0x80}
+		for b := v.Bytes; len(b) > 0; {
+			n := min(len(b), 32)
+			out = append(append(out, 0x04, byte(n)), b[:n]...)
+			b = b[n:]
+		}
+		return append(out, 0, 0)
+	}
+	return der
+}
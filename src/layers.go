@@ -0,0 +1,337 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tidwall/resp"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// configFields lists the fields of Config that are layered, with the flag and
+// environment variable that set each of them. Later layers override earlier ones:
+// defaults, then the config file, then environment variables, then flags.
+var configFields = []struct {
+	Name string
+	Flag string
+	Env  string
+}{
+	{"Addr", "addr", "ECHOVAULT_ADDR"},
+	{"Port", "port", "ECHOVAULT_PORT"},
+	{"URI", "uri", "ECHOVAULT_URI"},
+	{"Socket", "socket", "ECHOVAULT_SOCKET"},
+	{"TLS", "tls", "ECHOVAULT_TLS"},
+	{"MTLS", "mtls", "ECHOVAULT_MTLS"},
+	{"ServerCAs", "server-ca", "ECHOVAULT_SERVER_CAS"},
+	{"CADir", "ca-dir", "ECHOVAULT_CA_DIR"},
+	{"NoSystemCA", "no-system-ca", "ECHOVAULT_NO_SYSTEM_CA"},
+	{"CertKeyPairs", "cert-key-pair", "ECHOVAULT_CERT_KEY_PAIRS"},
+	{"TLSServerName", "tls-server-name", "ECHOVAULT_TLS_SERVER_NAME"},
+	{"TLSMinVersion", "tls-min-version", "ECHOVAULT_TLS_MIN_VERSION"},
+	{"TLSCipherSuites", "tls-cipher-suites", "ECHOVAULT_TLS_CIPHER_SUITES"},
+	{"Insecure", "insecure", "ECHOVAULT_INSECURE"},
+	{"TLSPins", "tls-pin", "ECHOVAULT_TLS_PINS"},
+	{"KeyPassphrase", "", KeyPassphraseEnv},
+	{"KeyPassphraseFile", "key-passphrase-file", "ECHOVAULT_KEY_PASSPHRASE_FILE"},
+	{"Username", "user", "ECHOVAULT_USER"},
+	{"Password", "pass", PasswordEnv},
+	{"Database", "", "ECHOVAULT_DATABASE"},
+	{"ConnectTimeout", "connect-timeout", "ECHOVAULT_CONNECT_TIMEOUT"},
+	{"Timeout", "timeout", "ECHOVAULT_TIMEOUT"},
+	{"KeepAlive", "keepalive", "ECHOVAULT_KEEPALIVE"},
+	{"ConfigPath", "config", "ECHOVAULT_CONFIG"},
+	{"Profile", "profile", "ECHOVAULT_PROFILE"},
+	{"CredentialsFile", "credentials-file", "ECHOVAULT_CREDENTIALS_FILE"},
+	{"File", "file", "ECHOVAULT_FILE"},
+	{"Window", "window", "ECHOVAULT_WINDOW"},
+	{"Pipe", "pipe", "ECHOVAULT_PIPE"},
+	{"Record", "record", "ECHOVAULT_RECORD"},
+	{"RecordSync", "record-sync", "ECHOVAULT_RECORD_SYNC"},
+	{"RecordWritesOnly", "record-writes-only", "ECHOVAULT_RECORD_WRITES_ONLY"},
+	{"HistoryFile", "history-file", "ECHOVAULT_HISTORY_FILE"},
+	{"HistorySize", "history-size", "ECHOVAULT_HISTORY_SIZE"},
+	{"ReconnectAttempts", "reconnect-attempts", "ECHOVAULT_RECONNECT_ATTEMPTS"},
+	{"RetryInFlight", "retry-in-flight", "ECHOVAULT_RETRY_IN_FLIGHT"},
+	{"Verbose", "verbose", "ECHOVAULT_VERBOSE"},
+}
+
+// configLayer holds the fields of a Config set by one source, and where each came from.
+type configLayer struct {
+	conf    Config
+	sources map[string]string
+}
+
+func newConfigLayer() *configLayer {
+	return &configLayer{sources: make(map[string]string)}
+}
+
+// set records that the field name was set by source.
+func (l *configLayer) set(name string, source string) {
+	l.sources[name] = source
+}
+
+// expandURI applies the URI set in the layer, so that the fields it contains
+// take the layer's place in the precedence order rather than overriding every layer.
+func (l *configLayer) expandURI() error {
+	source, ok := l.sources["URI"]
+	if !ok || len(l.conf.URI) == 0 {
+		return nil
+	}
+	set, err := l.conf.ApplyURI(l.conf.URI)
+	if err != nil {
+		return fmt.Errorf("invalid connection URI from %s: %s", source, err)
+	}
+	for _, name := range set {
+		l.set(name, "URI from "+source)
+	}
+	return nil
+}
+
+// mergeInto copies the fields set in the layer into conf.
+func (l *configLayer) mergeInto(conf *Config) {
+	dst := reflect.ValueOf(conf).Elem()
+	src := reflect.ValueOf(l.conf)
+	for name, source := range l.sources {
+		dst.FieldByName(name).Set(src.FieldByName(name))
+		conf.Sources[name] = source
+	}
+}
+
+// envLayer reads the ECHOVAULT_* environment variables. Empty variables are ignored.
+func envLayer() (*configLayer, error) {
+	layer := newConfigLayer()
+	v := reflect.ValueOf(&layer.conf).Elem()
+	for _, field := range configFields {
+		value, ok := os.LookupEnv(field.Env)
+		if !ok || len(value) == 0 {
+			continue
+		}
+		if err := setField(v.FieldByName(field.Name), value); err != nil {
+			return nil, fmt.Errorf("%s: %s", field.Env, err)
+		}
+		layer.set(field.Name, "env "+field.Env)
+	}
+	return layer, nil
+}
+
+// setField parses value into the field v. Lists are comma separated, and cert/key
+// pairs are separated by semicolons, e.g. "cert1,key1;cert2,key2".
+func setField(v reflect.Value, value string) error {
+	switch v.Interface().(type) {
+	case resp.SyncPolicy:
+		policy, err := ParseSyncPolicy(value)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(policy))
+		return nil
+	case Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q, expected a duration such as 5s", value)
+		}
+		v.Set(reflect.ValueOf(Duration(d)))
+		return nil
+	case []string:
+		v.Set(reflect.ValueOf(splitList(value, ",")))
+		return nil
+	case [][]string:
+		var pairs [][]string
+		for _, pair := range splitList(value, ";") {
+			paths := splitList(pair, ",")
+			if err := checkCertKeyPair(paths); err != nil {
+				return fmt.Errorf("invalid cert/key pair %q: %s", pair, err)
+			}
+			pairs = append(pairs, paths)
+		}
+		v.Set(reflect.ValueOf(pairs))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q, expected true or false", value)
+		}
+		v.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		v.SetInt(int64(n))
+	case reflect.Uint16:
+		n, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid port %q", value)
+		}
+		v.SetUint(n)
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
+
+func splitList(s string, sep string) []string {
+	var items []string
+	for _, item := range strings.Split(s, sep) {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Describe writes the settings of conf as YAML, with the source of each value in a comment.
+// Passwords are redacted.
+func (conf Config) Describe(w io.Writer) error {
+	redacted := reflect.ValueOf(conf.Redacted())
+	mapping := &yaml.Node{Kind: yaml.MappingNode}
+
+	for _, field := range configFields {
+		var value yaml.Node
+		v := redacted.FieldByName(field.Name).Interface()
+		if policy, ok := v.(resp.SyncPolicy); ok {
+			v = SyncPolicyName(policy)
+		}
+		if err := value.Encode(v); err != nil {
+			return err
+		}
+		if value.Kind == yaml.SequenceNode {
+			value.Style = yaml.FlowStyle
+		}
+
+		source, ok := conf.Sources[field.Name]
+		if !ok {
+			source = "default"
+		}
+		key := &yaml.Node{Kind: yaml.ScalarNode, Value: field.Name}
+		value.LineComment = source
+		mapping.Content = append(mapping.Content, key, &value)
+	}
+
+	b, err := encodeYAML(mapping)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// decodeMapping decodes the keys of a YAML mapping into the fields of the struct
+// that v points to, matched by their yaml tags. It returns the names of the fields
+// that were set. Unknown keys and invalid values are reported with their line and column.
+func decodeMapping(filePath string, node *yaml.Node, v reflect.Value) ([]string, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s:%d:%d: expected a mapping of settings", filePath, node.Line, node.Column)
+	}
+
+	fields := make(map[string]string)
+	var tags []string
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if tag, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ","); len(tag) > 0 && tag != "-" {
+			fields[tag] = t.Field(i).Name
+			tags = append(tags, tag)
+		}
+	}
+
+	var set []string
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		name, ok := fields[canonicalKey(filePath, key.Value, tags)]
+		if !ok {
+			return nil, fmt.Errorf("%s:%d:%d: unknown key %q", filePath, key.Line, key.Column, key.Value)
+		}
+		if err := decodeValue(filePath, value, v.FieldByName(name).Addr().Interface()); err != nil {
+			return nil, fmt.Errorf("%s:%d:%d: invalid value for %s: %s", filePath, value.Line, value.Column, key.Value, err)
+		}
+		set = append(set, name)
+	}
+	return set, nil
+}
+
+// decodeValue decodes node into out. Values in JSON files are decoded with
+// encoding/json, so they follow its rules rather than the looser YAML ones.
+func decodeValue(filePath string, node *yaml.Node, out any) error {
+	if path.Ext(filePath) != ".json" {
+		if err := node.Decode(out); err != nil {
+			return errors.New(yamlErrorMessage(err))
+		}
+		return nil
+	}
+
+	b, err := json.Marshal(jsonValue(node))
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(b, out); err != nil {
+		return errors.New(strings.TrimPrefix(err.Error(), "json: "))
+	}
+	return nil
+}
+
+// jsonValue returns the value of a node read by parseJSONDocument.
+func jsonValue(node *yaml.Node) any {
+	switch node.Kind {
+	case yaml.SequenceNode:
+		values := make([]any, len(node.Content))
+		for i, item := range node.Content {
+			values[i] = jsonValue(item)
+		}
+		return values
+	case yaml.MappingNode:
+		values := make(map[string]any)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			values[node.Content[i].Value] = jsonValue(node.Content[i+1])
+		}
+		return values
+	}
+	switch node.Tag {
+	case "!!int", "!!float":
+		return json.Number(node.Value)
+	case "!!bool":
+		return node.Value == "true"
+	case "!!null":
+		return nil
+	}
+	return node.Value
+}
+
+// canonicalKey returns the name in names that key refers to. Keys in JSON files
+// match case-insensitively, as encoding/json matches them, and YAML keys exactly.
+func canonicalKey(filePath string, key string, names []string) string {
+	if path.Ext(filePath) != ".json" {
+		return key
+	}
+	for _, name := range names {
+		if strings.EqualFold(name, key) {
+			return name
+		}
+	}
+	return key
+}
+
+// yamlErrorMessage strips the position that yaml adds to err, as the caller reports it.
+func yamlErrorMessage(err error) string {
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) && len(typeErr.Errors) > 0 {
+		msg := typeErr.Errors[0]
+		if _, rest, ok := strings.Cut(msg, ": "); ok && strings.HasPrefix(msg, "line ") {
+			return rest
+		}
+		return msg
+	}
+	return strings.TrimPrefix(err.Error(), "yaml: ")
+}
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// ErrInterrupted is returned by LineEditor.ReadLine when the user presses Ctrl-C.
+var ErrInterrupted = errors.New("interrupted")
+
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlG     = 7
+	keyBackspace = 8
+	keyTab       = 9
+	keyLineFeed  = 10
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlR     = 18
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyDelete    = 127
+
+	// Keys sent as escape sequences are mapped to values outside of the Unicode range.
+	keyUp rune = unicode.MaxRune + 1 + iota
+	keyDown
+	keyLeft
+	keyRight
+	keyHome
+	keyEnd
+	keyDeleteForward
+	keyWordLeft
+	keyWordRight
+	keyUnknown
+)
+
+// LineEditor reads lines from a terminal with cursor movement, emacs style
+// editing keys, history navigation and reverse history search.
+// When the terminal cannot be put into raw mode, lines are read as they are.
+type LineEditor struct {
+	in      *os.File
+	rd      *bufio.Reader
+	out     io.Writer
+	history *History
+
+	// Complete returns the completion candidates for the word that ends at pos
+	// in line, and the position that word starts at. It is called when Tab is pressed.
+	Complete func(line string, pos int) ([]string, int)
+
+	// Hint returns text that is shown dimmed after the end of line while it is
+	// being typed, such as the remaining arguments of a command.
+	Hint func(line string) string
+}
+
+func NewLineEditor(in *os.File, out io.Writer, history *History) *LineEditor {
+	return &LineEditor{
+		in:      in,
+		rd:      bufio.NewReader(in),
+		out:     out,
+		history: history,
+	}
+}
+
+// ReadLine shows prompt and returns the line entered by the user without the
+// trailing newline. It returns io.EOF when the input ends or the user presses
+// Ctrl-D on an empty line, and ErrInterrupted when the user presses Ctrl-C.
+// Lines that are returned are added to the history.
+func (e *LineEditor) ReadLine(prompt string) (string, error) {
+	restore, err := MakeRaw(e.in)
+	if err != nil {
+		return e.readPlainLine(prompt)
+	}
+	defer restore()
+
+	line, err := e.edit(prompt)
+	if err == nil {
+		if err := e.history.Add(line); err != nil {
+			fmt.Fprintf(e.out, "could not save history: %s\r\n", err)
+		}
+	}
+	return line, err
+}
+
+func (e *LineEditor) readPlainLine(prompt string) (string, error) {
+	io.WriteString(e.out, prompt)
+	line, err := e.rd.ReadString('\n')
+	if err != nil && len(line) == 0 {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if err := e.history.Add(line); err != nil {
+		fmt.Fprintf(e.out, "could not save history: %s\n", err)
+	}
+	return line, nil
+}
+
+// lineState is the line being edited and the position of the cursor in it.
+type lineState struct {
+	prompt string
+	buf    []rune
+	pos    int
+}
+
+func (e *LineEditor) refresh(s *lineState) {
+	// The hint is only shown while the cursor is at the end of the line.
+	hint := ""
+	if e.Hint != nil && s.pos == len(s.buf) && len(s.buf) > 0 {
+		if hint = e.Hint(string(s.buf)); len(hint) > 0 {
+			hint = "\x1b[2m" + hint + "\x1b[0m"
+		}
+	}
+
+	// Return to the start of the line, redraw it, clear the rest of the line,
+	// then move the cursor back into position.
+	fmt.Fprintf(e.out, "\r%s%s%s\x1b[K\r", s.prompt, string(s.buf), hint)
+	if col := len([]rune(s.prompt)) + s.pos; col > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dC", col)
+	}
+}
+
+func (e *LineEditor) edit(prompt string) (string, error) {
+	s := &lineState{prompt: prompt}
+
+	entries := e.history.Entries()
+	histIdx := len(entries)
+	// The line being typed is kept while browsing the history.
+	var scratch []rune
+
+	e.refresh(s)
+
+	var lastKey rune
+	for {
+		key, err := e.readKey()
+		if err != nil {
+			return "", err
+		}
+
+		prevKey := lastKey
+		lastKey = key
+
+		switch key {
+		case keyEnter, keyLineFeed:
+			io.WriteString(e.out, "\r\n")
+			return string(s.buf), nil
+
+		case keyCtrlC:
+			io.WriteString(e.out, "^C\r\n")
+			return "", ErrInterrupted
+
+		case keyCtrlD:
+			if len(s.buf) == 0 {
+				io.WriteString(e.out, "\r\n")
+				return "", io.EOF
+			}
+			s.deleteForward()
+
+		case keyCtrlA, keyHome:
+			s.pos = 0
+		case keyCtrlE, keyEnd:
+			s.pos = len(s.buf)
+		case keyCtrlB, keyLeft:
+			if s.pos > 0 {
+				s.pos--
+			}
+		case keyCtrlF, keyRight:
+			if s.pos < len(s.buf) {
+				s.pos++
+			}
+		case keyWordLeft:
+			s.pos = s.wordStart()
+		case keyWordRight:
+			for s.pos < len(s.buf) && s.buf[s.pos] == ' ' {
+				s.pos++
+			}
+			for s.pos < len(s.buf) && s.buf[s.pos] != ' ' {
+				s.pos++
+			}
+
+		case keyBackspace, keyDelete:
+			if s.pos > 0 {
+				s.buf = append(s.buf[:s.pos-1], s.buf[s.pos:]...)
+				s.pos--
+			}
+		case keyDeleteForward:
+			s.deleteForward()
+		case keyCtrlW:
+			start := s.wordStart()
+			s.buf = append(s.buf[:start], s.buf[s.pos:]...)
+			s.pos = start
+		case keyCtrlU:
+			s.buf = s.buf[s.pos:]
+			s.pos = 0
+		case keyCtrlK:
+			s.buf = s.buf[:s.pos]
+		case keyCtrlL:
+			io.WriteString(e.out, "\x1b[H\x1b[2J")
+
+		case keyUp, keyCtrlP:
+			if histIdx > 0 {
+				if histIdx == len(entries) {
+					scratch = append([]rune{}, s.buf...)
+				}
+				histIdx--
+				s.buf = []rune(entries[histIdx])
+				s.pos = len(s.buf)
+			}
+		case keyDown, keyCtrlN:
+			if histIdx < len(entries) {
+				histIdx++
+				if histIdx == len(entries) {
+					s.buf = scratch
+				} else {
+					s.buf = []rune(entries[histIdx])
+				}
+				s.pos = len(s.buf)
+			}
+
+		case keyTab:
+			e.complete(s, prevKey == keyTab)
+
+		case keyCtrlR:
+			line, accepted, err := e.reverseSearch(s)
+			if err != nil {
+				return "", err
+			}
+			if accepted {
+				return line, nil
+			}
+
+		default:
+			if key < unicode.MaxRune && unicode.IsPrint(key) {
+				s.buf = append(s.buf[:s.pos], append([]rune{key}, s.buf[s.pos:]...)...)
+				s.pos++
+			}
+		}
+
+		e.refresh(s)
+	}
+}
+
+// reverseSearch searches the history for lines containing the typed query,
+// newest first. Enter runs the match, Ctrl-R moves to the next older match,
+// Ctrl-G or Ctrl-C cancels, and any other key leaves the match in s for editing.
+func (e *LineEditor) reverseSearch(s *lineState) (string, bool, error) {
+	entries := e.history.Entries()
+	var query []rune
+	idx := len(entries)
+	match := ""
+
+	// find looks for the query in the entries older than from.
+	find := func(from int) {
+		for i := from - 1; i >= 0; i-- {
+			if strings.Contains(entries[i], string(query)) {
+				idx, match = i, entries[i]
+				return
+			}
+		}
+	}
+
+	for {
+		fmt.Fprintf(e.out, "\r(reverse-i-search)`%s': %s\x1b[K", string(query), match)
+
+		key, err := e.readKey()
+		if err != nil {
+			return "", false, err
+		}
+
+		switch key {
+		case keyEnter, keyLineFeed:
+			io.WriteString(e.out, "\r\n")
+			return match, true, nil
+		case keyCtrlG, keyCtrlC, keyEscape:
+			return "", false, nil
+		case keyCtrlR:
+			find(idx)
+		case keyBackspace, keyDelete:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				idx, match = len(entries), ""
+				find(idx)
+			}
+		default:
+			if key < unicode.MaxRune && unicode.IsPrint(key) {
+				query = append(query, key)
+				// Keep the current match if it still contains the query.
+				if !strings.Contains(match, string(query)) {
+					find(idx)
+				}
+				continue
+			}
+			s.buf = []rune(match)
+			s.pos = len(s.buf)
+			return "", false, nil
+		}
+	}
+}
+
+// complete completes the word before the cursor. A single candidate replaces the
+// word. With several candidates, their common prefix is inserted, and if there
+// is nothing to insert the candidates are listed when Tab is pressed twice.
+func (e *LineEditor) complete(s *lineState, list bool) {
+	if e.Complete == nil {
+		return
+	}
+
+	candidates, start := e.Complete(string(s.buf), s.pos)
+	if len(candidates) == 0 || start < 0 || start > s.pos {
+		io.WriteString(e.out, "\a")
+		return
+	}
+
+	replace := func(word string) {
+		rest := append([]rune(word), s.buf[s.pos:]...)
+		s.buf = append(s.buf[:start], rest...)
+		s.pos = start + len([]rune(word))
+	}
+
+	if len(candidates) == 1 {
+		replace(candidates[0] + " ")
+		return
+	}
+
+	prefix := []rune(candidates[0])
+	for _, candidate := range candidates[1:] {
+		c := []rune(candidate)
+		i := 0
+		for i < len(prefix) && i < len(c) && prefix[i] == c[i] {
+			i++
+		}
+		prefix = prefix[:i]
+	}
+
+	if len(prefix) > s.pos-start {
+		replace(string(prefix))
+		return
+	}
+
+	if !list {
+		io.WriteString(e.out, "\a")
+		return
+	}
+
+	io.WriteString(e.out, "\r\n")
+	for i, candidate := range candidates {
+		if i > 0 {
+			io.WriteString(e.out, "  ")
+		}
+		io.WriteString(e.out, candidate)
+	}
+	io.WriteString(e.out, "\r\n")
+}
+
+func (s *lineState) deleteForward() {
+	if s.pos < len(s.buf) {
+		s.buf = append(s.buf[:s.pos], s.buf[s.pos+1:]...)
+	}
+}
+
+// wordStart returns the position of the start of the word before the cursor.
+func (s *lineState) wordStart() int {
+	i := s.pos
+	for i > 0 && s.buf[i-1] == ' ' {
+		i--
+	}
+	for i > 0 && s.buf[i-1] != ' ' {
+		i--
+	}
+	return i
+}
+
+// readKey reads a key press, decoding escape sequences for the arrow keys and
+// other special keys.
+func (e *LineEditor) readKey() (rune, error) {
+	r, _, err := e.rd.ReadRune()
+	if err != nil || r != keyEscape {
+		return r, err
+	}
+
+	// A lone escape is not followed by more input.
+	if e.rd.Buffered() == 0 {
+		return keyEscape, nil
+	}
+
+	r, _, err = e.rd.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+
+	switch r {
+	case 'b':
+		return keyWordLeft, nil
+	case 'f':
+		return keyWordRight, nil
+	case '[', 'O':
+	default:
+		return keyUnknown, nil
+	}
+
+	// Read the parameters and the final byte of a CSI or SS3 sequence.
+	var params []rune
+	for {
+		c, _, err := e.rd.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		if c >= 0x40 && c <= 0x7e {
+			switch c {
+			case 'A':
+				return keyUp, nil
+			case 'B':
+				return keyDown, nil
+			case 'C':
+				return keyRight, nil
+			case 'D':
+				return keyLeft, nil
+			case 'H':
+				return keyHome, nil
+			case 'F':
+				return keyEnd, nil
+			case '~':
+				switch string(params) {
+				case "1", "7":
+					return keyHome, nil
+				case "4", "8":
+					return keyEnd, nil
+				case "3":
+					return keyDeleteForward, nil
+				}
+			}
+			return keyUnknown, nil
+		}
+		params = append(params, c)
+	}
+}
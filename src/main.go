@@ -1,10 +1,8 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
-	"crypto/tls"
-	"crypto/x509"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
@@ -14,148 +12,231 @@ import (
 )
 
 func main() {
-	conf := GetConfig()
-
-	var conn net.Conn
-	var err error
-
-	// Writers & readers for stdio
-	stdout, stdin := io.Writer(os.Stdin), io.Reader(os.Stdout)
-
-	dialer := net.Dialer{
-		KeepAlive: 200 * time.Millisecond,
+	defaults, flags := ParseFlags()
+
+	// Any arguments left after the flags form a single command to run non-interactively.
+	args := flag.Args()
+
+	// config init may replace a config file that does not load, and profile loads the
+	// config file itself, so both run before the config file is loaded.
+	if len(args) > 0 {
+		switch args[0] {
+		case "profile":
+			os.Exit(RunProfile(GetConfigLocation(defaults, flags), args[1:]))
+		case "config":
+			// Other arguments are sent to the server as a CONFIG command.
+			if len(args) > 1 && args[1] == "init" {
+				os.Exit(RunConfigInit(args[2:], os.Stdin, os.Stdout))
+			}
+		}
 	}
 
-	if conf.TLS || conf.MTLS {
-		// Dial TLS
-		if _, err = stdout.Write([]byte("Establishing TLS connection...\n")); err != nil {
+	conf := GetConfig(defaults, flags)
+
+	if conf.PrintConfig {
+		// The settings are still printed when the credentials file cannot be read.
+		if err := conf.ApplyCredentialsFile(); err != nil {
 			log.Println(err)
 		}
+		if err := conf.Describe(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	}
 
-		var certificates []tls.Certificate
-		for _, certKeyPair := range conf.CertKeyPairs {
-			c, err := tls.LoadX509KeyPair(certKeyPair[0], certKeyPair[1])
-			if err != nil {
-				log.Fatal(err)
+	// Writers & readers for stdio
+	stdout, stdin := io.Writer(os.Stdout), io.Reader(os.Stdin)
+
+	if len(args) > 0 {
+		switch args[0] {
+		case "replay":
+			os.Exit(RunReplay(conf, args[1:]))
+		case "tls":
+			// Other arguments are sent to the server as a command.
+			if len(args) > 1 && args[1] == "inspect" {
+				os.Exit(RunTLSInspect(conf, args[2:], stdout))
 			}
-			certificates = append(certificates, c)
 		}
+	}
 
-		serverCAs := x509.NewCertPool()
-		for _, authority := range conf.ServerCAs {
-			f, err := os.Open(authority)
-			if err != nil {
-				panic(err)
-			}
-			cert, err := io.ReadAll(bufio.NewReader(f))
+	// Commands are run in batch mode from a file, or from stdin when it is not a terminal.
+	// In pipe mode the input is always read from the file or stdin.
+	var batch io.Reader
+	if len(args) == 0 || conf.Pipe {
+		if len(conf.File) > 0 {
+			f, err := os.Open(conf.File)
 			if err != nil {
-				panic(err)
-			}
-			ok := serverCAs.AppendCertsFromPEM(cert)
-			if !ok {
-				panic("Failed to parse certificate")
+				log.Fatal(err)
 			}
+			defer f.Close()
+			batch = f
+		} else if conf.Pipe || !IsTerminal(os.Stdin) {
+			batch = stdin
 		}
+	}
 
-		conn, err = tls.DialWithDialer(&dialer, "tcp", fmt.Sprintf("%s:%d", conf.Addr, conf.Port), &tls.Config{
-			RootCAs:      serverCAs,
-			Certificates: certificates,
-		})
+	status := stdout
+	if len(args) > 0 || batch != nil {
+		// Keep the output of non-interactive runs limited to the replies.
+		status = io.Discard
+	}
 
-		if err != nil {
-			panic(fmt.Sprintf("Handshake Error: %s", err.Error()))
+	if err := conf.ApplyCredentialsFile(); err != nil {
+		log.Fatal(err)
+	}
+	if err := conf.ResolvePassword(); err != nil {
+		log.Fatal(err)
+	}
+	if err := conf.ResolveKeyPassphrase(); err != nil {
+		log.Fatal(err)
+	}
+
+	var rec *Recorder
+	if len(conf.Record) > 0 && len(args) == 0 && !conf.Pipe {
+		var err error
+		if rec, err = NewRecorder(conf.Record, conf.RecordSync, conf.RecordWritesOnly); err != nil {
+			log.Fatal(err)
 		}
-	} else {
-		stdout.Write([]byte("Establishing TCP connection...\n"))
-		conn, err = dialer.Dial("tcp", fmt.Sprintf("%s:%d", conf.Addr, conf.Port))
+	}
+
+	if len(args) == 0 && batch == nil && (conf.TLS || conf.MTLS) && len(conf.CertKeyPairs) > 0 {
+		// Interactive sessions can outlive a client certificate, so rotated certificates are
+		// reloaded and used when reconnecting.
+		certificates, err := LoadClientCertificates(conf)
 		if err != nil {
-			panic(err)
+			log.Fatal(err)
+		}
+		go certificates.Watch(certReloadInterval)
+		conf.ClientCertificates = certificates
+	}
+
+	conn := Connect(conf, status)
+
+	if len(args) > 0 || batch != nil {
+		var code int
+		if conf.Pipe {
+			code = RunPipe(conn, batch, conf.Window, time.Duration(conf.Timeout), stdout, os.Stderr)
+		} else if batch != nil {
+			code = RunBatch(conn, batch, conf.Window, time.Duration(conf.Timeout), rec, stdout, os.Stderr)
+		} else {
+			code = RunCommand(conn, args, time.Duration(conf.Timeout))
+		}
+		conn.Close()
+		if err := rec.Close(); err != nil {
+			log.Println(err)
 		}
+		os.Exit(code)
 	}
 
 	defer conn.Close()
+	defer rec.Close()
 
-	done := make(chan struct{})
-
-	// Writers & readers for connection
-	cw, cr := io.Writer(conn), io.Reader(conn)
-
-	go func() {
-		for {
-			stdout.Write([]byte("\n> "))
-
-			if in, err := ReadMessage(stdin, []byte{'\n'}); err != nil {
-				log.Println(err)
-			} else {
-				in := bytes.TrimSpace(in)
-
-				if bytes.Equal(bytes.ToLower(in), []byte("quit\n\x00\x00\x00")) {
-					break
-				}
-
-				// Serialize command and send to connection
-				encoded, err := Encode(string(in))
-
-				if err != nil {
-					fmt.Println(err)
-					continue
-				}
-
-				if _, err := cw.Write([]byte(encoded)); err != nil {
-					log.Println(err)
-				}
-
-				// Read response from server
-				message, err := ReadMessage(cr, []byte{'\r', '\n', '\r', '\n'})
-
-				if err != nil && err == io.EOF {
-					log.Println("connection closed")
-					break
-				} else if err != nil {
-					log.Println(err)
-				}
-
-				decoded, err := Decode(message)
-				if err != nil {
-					log.Println(err)
-					continue
-				}
-
-				if IsSubscribeResponse(decoded) {
-					// If we're subscribed to a channel, listen for messages from the channel
-					func() {
-						for {
-							var message []byte
-
-							if msg, err := ReadMessage(cr, []byte{'\r', '\n', '\r', '\n'}); err != nil {
-								if err == io.EOF {
-									return
-								}
-								log.Println(err)
-								continue
-							} else {
-								message = msg
-							}
-
-							decoded, err := Decode(message)
-							if err != nil {
-								log.Println(err)
-								continue
-							}
-
-							cw.Write([]byte("+ACK\r\n\r\n"))
-							if !decoded.IsNull() {
-								PrintDecoded(decoded)
-							}
-						}
-					}()
-				} else {
-					PrintDecoded(decoded)
-				}
-			}
+	history, err := LoadHistory(conf.HistoryFile, conf.HistorySize)
+	if err != nil {
+		log.Println(err)
+	}
+
+	client := NewClient(conn, conf.Address())
+	client.Redial = func() (net.Conn, error) { return Dial(conf, io.Discard) }
+	client.ReconnectAttempts = conf.ReconnectAttempts
+	client.Timeout = time.Duration(conf.Timeout)
+	client.Status = func(msg string) { fmt.Fprintln(stdout, msg) }
+
+	RunREPL(client, rec, history, os.Stdin, stdout, conf.RetryInFlight)
+}
+
+// Connect dials the server described by conf and writes connection progress to status.
+// It exits with ExitAuthFailed if the server rejects the credentials, and with 1 if the
+// connection cannot be established. A warning is printed when the server's certificate
+// is not verified; reconnects go through Dial so it is only printed once.
+func Connect(conf Config, status io.Writer) net.Conn {
+	if conf.Insecure && (conf.TLS || conf.MTLS) {
+		if len(conf.TLSPins) > 0 {
+			fmt.Fprintln(os.Stderr, "WARNING: --insecure is set, so the server's certificate chain is only checked against --tls-pin.")
+		} else {
+			fmt.Fprintln(os.Stderr, "WARNING: --insecure is set, so the server's certificate is not verified.")
+			fmt.Fprintln(os.Stderr, "WARNING: Anyone on the network path can impersonate the server. Only use this with development servers.")
+		}
+	}
+
+	conn, err := Dial(conf, status)
+	if err != nil {
+		var authErr *AuthError
+		if errors.As(err, &authErr) {
+			fmt.Fprintln(os.Stderr, authErr)
+			os.Exit(ExitAuthFailed)
+		}
+		var handshakeErr *HandshakeError
+		if errors.As(err, &handshakeErr) {
+			log.Fatalf("%s\nRun `echovault-cli tls inspect` with the same options to see the server's certificate chain.", err)
+		}
+		log.Fatal(err)
+	}
+	return conn
+}
+
+// Dial dials the server described by conf and writes connection progress to status.
+func Dial(conf Config, status io.Writer) (net.Conn, error) {
+	transport, err := NewTransport(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := net.Dialer{
+		Timeout:   time.Duration(conf.ConnectTimeout),
+		KeepAlive: time.Duration(conf.KeepAlive),
+	}
+
+	if _, err = fmt.Fprintf(status, "Establishing %s connection...\n", transport); err != nil {
+		log.Println(err)
+	}
+
+	conn, err := transport.Dial(&dialer)
+	if err != nil {
+		return nil, err
+	}
+
+	// Authenticating and selecting the database are part of establishing the connection.
+	if conf.ConnectTimeout > 0 {
+		conn.SetDeadline(time.Now().Add(time.Duration(conf.ConnectTimeout)))
+	}
+	if err = handshake(conn, conf); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	return conn, nil
+}
+
+// RunCommand sends a single command made up of args, prints the reply and
+// returns the process exit code. The exit code is 1 when the server replies
+// with an error or the reply cannot be read within timeout, if it is not zero.
+func RunCommand(conn net.Conn, args []string, timeout time.Duration) int {
+	if _, err := conn.Write([]byte(EncodeTokens(args))); err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	if timeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+	}
+	decoded, err := NewRespReader(conn).ReadValue()
+	if err != nil {
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			log.Printf("no reply within %s", timeout)
+		} else if IsConnectionClosed(err) {
+			log.Println("connection closed")
+		} else {
+			log.Println(err)
 		}
-		done <- struct{}{}
-	}()
+		return 1
+	}
 
-	<-done
+	PrintDecoded(decoded)
+
+	if decoded.Type().String() == "Error" {
+		return 1
+	}
+	return 0
 }
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/tidwall/resp"
+)
+
+// RunPipe streams RESP encoded commands from r to the server as they are, without
+// re-encoding them. Each command is checked to be a valid RESP array of bulk
+// strings before it is sent, and replies are read concurrently. A summary of the
+// replies and errors is written to stdout at the end. It returns the process exit code.
+func RunPipe(conn net.Conn, r io.Reader, window int, timeout time.Duration, stdout, stderr io.Writer) int {
+	start := time.Now()
+
+	// Every byte consumed by the RESP reader is also written to raw, so the exact
+	// bytes of each validated command can be forwarded to the server.
+	var raw bytes.Buffer
+	rd := resp.NewReader(io.TeeReader(r, &raw))
+
+	var offset, count int
+
+	next := func() (PipelineCommand, error) {
+		for {
+			v, telnet, n, err := rd.ReadMultiBulk()
+			if err == io.EOF {
+				return PipelineCommand{}, io.EOF
+			}
+			if err != nil {
+				return PipelineCommand{}, fmt.Errorf("invalid RESP at byte %d: %w", offset, err)
+			}
+
+			if telnet {
+				if len(v.Array()) == 0 {
+					// Skip blank lines between commands.
+					raw.Next(n)
+					offset += n
+					continue
+				}
+				return PipelineCommand{}, fmt.Errorf("invalid RESP at byte %d: expected an array of bulk strings", offset)
+			}
+
+			// ReadMultiBulk also accepts empty and null arrays, and elements of any type.
+			if v.IsNull() || len(v.Array()) == 0 {
+				return PipelineCommand{}, fmt.Errorf("invalid RESP at byte %d: expected a non-empty array of bulk strings", offset)
+			}
+			for i, element := range v.Array() {
+				if element.Type() != resp.BulkString {
+					return PipelineCommand{}, fmt.Errorf("invalid RESP at byte %d: element %d has type %s, expected a bulk string", offset, i+1, element.Type())
+				}
+			}
+
+			count++
+			label := fmt.Sprintf("command %d at byte %d (%s)", count, offset, v.Array()[0].String())
+
+			offset += n
+			return PipelineCommand{Data: raw.Next(n), Label: label}, nil
+		}
+	}
+
+	res := Pipeline(conn, window, timeout, next, nil, stderr)
+	if res.Err != nil {
+		fmt.Fprintln(stderr, res.Err)
+	}
+
+	fmt.Fprintf(stdout, "replies: %d, errors: %d, elapsed: %s\n",
+		res.Replies, res.Failed, time.Since(start).Round(time.Millisecond))
+
+	if res.Failed > 0 || res.Err != nil {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestRunPipeRejectsInvalidCommands(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"*1\r\n:5\r\n", "invalid RESP at byte 0: element 1 has type Integer"},
+		{"*0\r\n", "invalid RESP at byte 0: expected a non-empty array"},
+		{"*-1\r\n", "invalid RESP at byte 0: expected a non-empty array"},
+		{"*2\r\n$3\r\nGET\r\n*1\r\n$1\r\na\r\n", "invalid RESP at byte 0: element 2 has type Array"},
+		{"*1\r\n+PING\r\n", "invalid RESP at byte 0: element 1 has type SimpleString"},
+		{"PING\r\n", "invalid RESP at byte 0: expected an array of bulk strings"},
+	}
+
+	for _, tt := range tests {
+		client, server := net.Pipe()
+		// Nothing may reach the server, so a write would block the test.
+		var stderr bytes.Buffer
+		code := RunPipe(client, strings.NewReader(tt.input), 10, 0, io.Discard, &stderr)
+		client.Close()
+		server.Close()
+
+		if code != 1 {
+			t.Errorf("%q: got exit code %d, want 1", tt.input, code)
+		}
+		if !strings.Contains(stderr.String(), tt.want) {
+			t.Errorf("%q: got %q, want it to contain %q", tt.input, stderr.String(), tt.want)
+		}
+	}
+}
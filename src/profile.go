@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// RunProfile implements the profile subcommand, which lists, shows and switches
+// between the profiles of the --config file. It returns the process exit code.
+func RunProfile(conf Config, args []string) int {
+	usage := "usage: profile list | profile show [name] | profile use <name>"
+
+	if len(conf.ConfigPath) == 0 {
+		fmt.Fprintln(os.Stderr, "profile: no config file found, use --config or create one with config init")
+		return 2
+	}
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	file, err := LoadConfigFile(conf.ConfigPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		listProfiles(file, os.Stdout)
+	case args[0] == "show" && len(args) <= 2:
+		name := conf.Profile
+		if len(args) == 2 {
+			name = args[1]
+		}
+		err = showProfile(file, name, conf.ConfigPath, os.Stdout)
+	case args[0] == "use" && len(args) == 2:
+		if err = useProfile(file, args[1], conf.ConfigPath); err == nil {
+			fmt.Printf("Switched to profile %q\n", args[1])
+		}
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// listProfiles prints the profile names, marking the current profile with a *.
+func listProfiles(file ConfigFile, w io.Writer) {
+	for _, name := range file.ProfileNames() {
+		marker := " "
+		if name == file.CurrentProfile {
+			marker = "*"
+		}
+		fmt.Fprintf(w, "%s %s\n", marker, name)
+	}
+}
+
+// showProfile prints the settings of the named profile with its secrets redacted,
+// in the format of the config file.
+func showProfile(file ConfigFile, name string, filePath string, w io.Writer) error {
+	conf, _, err := file.Profile(name)
+	if err != nil {
+		return err
+	}
+	conf = conf.Redacted()
+
+	if path.Ext(filePath) == ".json" {
+		b, err := json.MarshalIndent(conf, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	}
+	b, err := encodeYAML(conf)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// useProfile makes name the current profile of the config file at filePath.
+func useProfile(file ConfigFile, name string, filePath string) error {
+	if _, ok := file.Profiles[name]; !ok {
+		_, _, err := file.Profile(name)
+		return err
+	}
+
+	b, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	if path.Ext(filePath) == ".json" {
+		b, err = setJSONKey(b, "CurrentProfile", name)
+	} else {
+		b, err = setYAMLKey(b, "CurrentProfile", name)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %s", filePath, err)
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, b, info.Mode().Perm())
+}
+
+// setJSONKey sets a top level key of a JSON object. An existing key is matched
+// case-insensitively, as LoadConfigFile matches it, and keeps its spelling. The other
+// keys are kept as they are, but the object is written back with its keys sorted.
+func setJSONKey(b []byte, key string, value string) ([]byte, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(b, &object); err != nil {
+		return nil, err
+	}
+	if object == nil {
+		object = make(map[string]json.RawMessage)
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	found := false
+	for k := range object {
+		if strings.EqualFold(k, key) {
+			object[k] = encoded
+			found = true
+		}
+	}
+	if !found {
+		object[key] = encoded
+	}
+	b, err = json.MarshalIndent(object, "", "  ")
+	return append(b, '\n'), err
+}
+
+// setYAMLKey sets a top level key of a YAML mapping, keeping the rest of the
+// document, including its comments, as it is.
+func setYAMLKey(b []byte, key string, value string) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	mapping := doc.Content[0]
+	if mapping.Kind != yaml.MappingNode {
+		return nil, errors.New("expected a mapping at the top level")
+	}
+
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content[i+1].SetString(value)
+			return encodeYAML(&doc)
+		}
+	}
+	mapping.Content = append([]*yaml.Node{
+		{Kind: yaml.ScalarNode, Value: key},
+		{Kind: yaml.ScalarNode, Value: value},
+	}, mapping.Content...)
+	return encodeYAML(&doc)
+}
+
+func encodeYAML(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	err := enc.Close()
+	return buf.Bytes(), err
+}
+
+// Redacted returns a copy of conf with its passwords replaced by "xxxxx".
+func (conf Config) Redacted() Config {
+	if len(conf.Password) > 0 {
+		conf.Password = "xxxxx"
+	}
+	if len(conf.KeyPassphrase) > 0 {
+		conf.KeyPassphrase = "xxxxx"
+	}
+	if u, err := url.Parse(conf.URI); err == nil {
+		conf.URI = u.Redacted()
+	}
+	return conf
+}
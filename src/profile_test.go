@@ -0,0 +1,34 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSetJSONKeyReplacesKeyInAnyCase(t *testing.T) {
+	b, err := setJSONKey([]byte(`{"currentProfile": "dev", "Port": 7480}`), "CurrentProfile", "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var object map[string]any
+	if err = json.Unmarshal(b, &object); err != nil {
+		t.Fatal(err)
+	}
+	if len(object) != 2 || object["currentProfile"] != "prod" {
+		t.Errorf("got %s, want currentProfile replaced with prod", b)
+	}
+}
+
+func TestSetJSONKeyAddsMissingKey(t *testing.T) {
+	b, err := setJSONKey([]byte(`{"Port": 7480}`), "CurrentProfile", "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var object map[string]any
+	if err = json.Unmarshal(b, &object); err != nil {
+		t.Fatal(err)
+	}
+	if object["CurrentProfile"] != "prod" {
+		t.Errorf("got %s, want CurrentProfile set to prod", b)
+	}
+}
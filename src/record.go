@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/tidwall/resp"
+)
+
+// readOnlyCommands are the commands that do not modify the keyspace. They are
+// left out of recordings when only write commands are recorded.
+var readOnlyCommands = []string{
+	"GET", "MGET", "GETRANGE", "SUBSTR", "STRLEN",
+	"EXISTS", "TTL", "PTTL", "EXPIRETIME", "PEXPIRETIME", "TYPE", "KEYS", "SCAN", "RANDOMKEY", "DBSIZE",
+	"HGET", "HMGET", "HGETALL", "HKEYS", "HVALS", "HLEN", "HEXISTS", "HSTRLEN", "HRANDFIELD", "HSCAN",
+	"LRANGE", "LINDEX", "LLEN",
+	"SMEMBERS", "SISMEMBER", "SMISMEMBER", "SCARD", "SRANDMEMBER", "SDIFF", "SINTER", "SINTERCARD", "SUNION", "SSCAN",
+	"ZRANGE", "ZRANGEBYSCORE", "ZRANGEBYLEX", "ZREVRANGE", "ZSCORE", "ZMSCORE", "ZCARD", "ZCOUNT", "ZLEXCOUNT",
+	"ZRANK", "ZREVRANK", "ZRANDMEMBER", "ZDIFF", "ZINTER", "ZUNION", "ZSCAN",
+	"PING", "ECHO", "INFO", "COMMANDS", "COMMAND", "LASTSAVE", "TIME",
+}
+
+// ParseSyncPolicy parses the name of an AOF sync policy.
+func ParseSyncPolicy(s string) (resp.SyncPolicy, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "never":
+		return resp.Never, nil
+	case "everysec", "every-second":
+		return resp.EverySecond, nil
+	case "always":
+		return resp.Always, nil
+	}
+	return resp.Never, fmt.Errorf("unknown sync policy %q, expected never, everysec or always", s)
+}
+
+// SyncPolicyName returns the name ParseSyncPolicy accepts for policy.
+func SyncPolicyName(policy resp.SyncPolicy) string {
+	switch policy {
+	case resp.Never:
+		return "never"
+	case resp.Always:
+		return "always"
+	}
+	return "everysec"
+}
+
+// Recorder appends the commands of a session to an AOF formatted file so the
+// session can be reproduced later with the replay subcommand. A nil *Recorder
+// records nothing.
+type Recorder struct {
+	aof        *resp.AOF
+	writesOnly bool
+}
+
+// NewRecorder opens the AOF file at path for recording. Commands are appended
+// to the file if it already exists.
+func NewRecorder(path string, policy resp.SyncPolicy, writesOnly bool) (*Recorder, error) {
+	aof, err := resp.OpenAOF(path)
+	if err != nil {
+		return nil, err
+	}
+	aof.SetSyncPolicy(policy)
+	return &Recorder{aof: aof, writesOnly: writesOnly}, nil
+}
+
+// Record appends the command made up of tokens if the server accepted it.
+// Commands that received an error reply are not recorded, and neither are
+// commands that may contain a password, as IsSensitiveCommand reports them.
+func (r *Recorder) Record(tokens []string, reply resp.Value) error {
+	if r == nil || len(tokens) == 0 || reply.Type().String() == "Error" {
+		return nil
+	}
+	if isSensitiveTokens(tokens) {
+		return nil
+	}
+
+	name := strings.ToUpper(tokens[0])
+	if r.writesOnly && slices.Contains(readOnlyCommands, name) {
+		return nil
+	}
+
+	values := make([]resp.Value, len(tokens))
+	values[0] = resp.StringValue(name)
+	for i := 1; i < len(tokens); i++ {
+		values[i] = resp.StringValue(tokens[i])
+	}
+
+	return r.aof.Append(resp.ArrayValue(values))
+}
+
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	return r.aof.Close()
+}
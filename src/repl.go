@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// RunREPL reads commands from the terminal line by line, sends them to the server and
+// prints each reply until the user quits or the connection is closed for good.
+// Successful commands are recorded with rec, which may be nil. When the connection
+// drops, the client reconnects; the command that was in flight is only sent again
+// when retryInFlight is set, as it may already have run.
+func RunREPL(client *Client, rec *Recorder, history *History, stdin *os.File, stdout io.Writer, retryInFlight bool) {
+	done := make(chan struct{})
+
+	go func() {
+		editor := NewLineEditor(stdin, stdout, history)
+		completer := NewCompleter(client, LoadCommands(client))
+		editor.Complete = completer.Complete
+		editor.Hint = completer.Hint
+
+		for {
+			stdout.Write([]byte("\n"))
+
+			prompt := "> "
+			if !client.Connected() {
+				prompt = "(disconnected) > "
+			}
+
+			if in, err := editor.ReadLine(prompt); err != nil {
+				if err == ErrInterrupted {
+					continue
+				}
+				if err != io.EOF {
+					log.Println(err)
+				}
+				break
+			} else {
+				in := strings.TrimSpace(in)
+
+				if len(in) == 0 {
+					continue
+				}
+
+				if strings.EqualFold(in, "quit") {
+					break
+				}
+
+				// Serialize command
+				tokens, err := tokenize(in)
+
+				if err != nil {
+					fmt.Println("could not parse command")
+					continue
+				}
+
+				if !client.Connected() && client.Reconnect() != nil {
+					continue
+				}
+
+				// Send command to connection and read response from server
+				decoded, err := client.Do(tokens...)
+
+				if errors.Is(err, ErrTimeout) {
+					fmt.Fprintf(stdout, "No reply within %s. The command may still run on the server.\n", client.Timeout)
+					if !client.Connected() {
+						fmt.Fprintln(stdout, "The reply was cut off, so the connection was closed. It is re-established with the next command.")
+					}
+					continue
+				}
+
+				if err != nil && !client.Connected() {
+					if !client.CanReconnect() {
+						log.Println("connection closed")
+						break
+					}
+					if client.Reconnect() != nil {
+						continue
+					}
+					if !retryInFlight {
+						fmt.Fprintln(stdout, "The connection was lost before the reply was received, so the command may not have run.")
+						continue
+					}
+					decoded, err = client.Do(tokens...)
+				}
+
+				if err != nil {
+					log.Println(err)
+					continue
+				}
+
+				client.Track(tokens, decoded)
+
+				if err = rec.Record(tokens, decoded); err != nil {
+					log.Println(err)
+				}
+
+				if IsSubscribeResponse(decoded) {
+					// If we're subscribed to a channel, listen for messages from the channel
+					func() {
+						for {
+							decoded, err := client.Receive()
+							if err != nil {
+								if !client.Connected() {
+									// Reconnecting restores the subscriptions, so keep listening.
+									if client.CanReconnect() && client.Reconnect() == nil {
+										continue
+									}
+									return
+								}
+								log.Println(err)
+								continue
+							}
+
+							client.Ack()
+							if !decoded.IsNull() {
+								PrintDecoded(decoded)
+							}
+						}
+					}()
+				} else {
+					PrintDecoded(decoded)
+				}
+			}
+		}
+		done <- struct{}{}
+	}()
+
+	<-done
+}
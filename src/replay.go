@@ -0,0 +1,208 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tidwall/resp"
+)
+
+// RunReplay implements the replay subcommand. It sends every command in an
+// append-only file to the server described by conf and returns the process exit code.
+func RunReplay(conf Config, args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	aofPath := fs.String("aof", "", "File path to the append-only file to replay.")
+	rate := fs.Int("rate", 0, "The maximum number of commands sent per second. Default is 0 (no limit).")
+	dryRun := fs.Bool("dry-run", false, "Count the commands in the file by name without sending them.")
+	skip := fs.String(
+		"skip",
+		"FLUSHALL,FLUSHDB",
+		"Comma separated list of commands that are not sent to the server. Default is FLUSHALL,FLUSHDB.",
+	)
+	fs.Parse(args)
+
+	if len(*aofPath) == 0 {
+		fmt.Fprintln(os.Stderr, "replay: --aof is required")
+		return 2
+	}
+
+	// resp.OpenAOF creates missing files, so check that the file exists first.
+	if _, err := os.Stat(*aofPath); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	aof, err := resp.OpenAOF(*aofPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer aof.Close()
+
+	var skipped []string
+	for _, name := range strings.Split(*skip, ",") {
+		if name = strings.ToUpper(strings.TrimSpace(name)); len(name) > 0 {
+			skipped = append(skipped, name)
+		}
+	}
+
+	if *dryRun {
+		return replayDryRun(aof, skipped, os.Stdout, os.Stderr)
+	}
+
+	start := time.Now()
+
+	// AOF.Scan cannot be stopped part way through, so the values are handed over
+	// to the pipeline through a channel. Once the pipeline stops, the remaining
+	// values are discarded.
+	values := make(chan resp.Value)
+	quit := make(chan struct{})
+	var scanErr error
+	go func() {
+		defer close(values)
+		scanErr = aof.Scan(func(v resp.Value) {
+			select {
+			case values <- v:
+			case <-quit:
+			}
+		})
+	}()
+
+	var limiter <-chan time.Time
+	if *rate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(*rate))
+		defer ticker.Stop()
+		limiter = ticker.C
+	}
+
+	var total, skipCount, invalid int
+
+	next := func() (PipelineCommand, error) {
+		for v := range values {
+			total++
+
+			tokens, ok := commandTokens(v)
+			if !ok {
+				invalid++
+				fmt.Fprintf(os.Stderr, "command %d: not a command, skipping\n", total)
+				continue
+			}
+
+			if slices.Contains(skipped, strings.ToUpper(tokens[0])) {
+				skipCount++
+				continue
+			}
+
+			if limiter != nil {
+				<-limiter
+			}
+
+			return PipelineCommand{
+				Data:  []byte(EncodeTokens(tokens)),
+				Label: fmt.Sprintf("command %d (%s)", total, tokens[0]),
+			}, nil
+		}
+		if scanErr != nil {
+			return PipelineCommand{}, scanErr
+		}
+		return PipelineCommand{}, io.EOF
+	}
+
+	if err := conf.ApplyCredentialsFile(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := conf.ResolvePassword(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := conf.ResolveKeyPassphrase(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	conn := Connect(conf, io.Discard)
+	defer conn.Close()
+
+	res := Pipeline(conn, conf.Window, time.Duration(conf.Timeout), next, nil, os.Stderr)
+	close(quit)
+	if res.Err != nil {
+		fmt.Fprintln(os.Stderr, res.Err)
+	}
+
+	failed := res.Failed + invalid
+
+	fmt.Fprintf(os.Stdout, "commands: %d, sent: %d, skipped: %d, errors: %d, elapsed: %s\n",
+		total, res.Sent, skipCount, failed, time.Since(start).Round(time.Millisecond))
+
+	if failed > 0 || res.Err != nil {
+		return 1
+	}
+	return 0
+}
+
+// replayDryRun counts the commands in aof by name and prints the totals.
+func replayDryRun(aof *resp.AOF, skipped []string, stdout, stderr io.Writer) int {
+	counts := make(map[string]int)
+	var total, invalid int
+
+	err := aof.Scan(func(v resp.Value) {
+		total++
+		tokens, ok := commandTokens(v)
+		if !ok {
+			invalid++
+			return
+		}
+		counts[strings.ToUpper(tokens[0])]++
+	})
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	// Most frequent commands first.
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	for _, name := range names {
+		suffix := ""
+		if slices.Contains(skipped, name) {
+			suffix = " (skipped)"
+		}
+		fmt.Fprintf(stdout, "%-20s %d%s\n", name, counts[name], suffix)
+	}
+	if invalid > 0 {
+		fmt.Fprintf(stdout, "%-20s %d\n", "(invalid)", invalid)
+	}
+	fmt.Fprintf(stdout, "commands: %d\n", total)
+
+	return 0
+}
+
+// commandTokens returns the name and arguments of a command stored as a RESP array.
+func commandTokens(v resp.Value) ([]string, bool) {
+	if v.Type().String() != "Array" || len(v.Array()) == 0 {
+		return nil, false
+	}
+	tokens := make([]string, len(v.Array()))
+	for i, item := range v.Array() {
+		if item.Type().String() == "Array" {
+			return nil, false
+		}
+		tokens[i] = item.String()
+	}
+	return tokens, true
+}
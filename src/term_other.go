@@ -0,0 +1,21 @@
+//go:build !linux && !darwin && !windows
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// ttyPath is the controlling terminal, which secrets are prompted for on.
+const ttyPath = "/dev/tty"
+
+// MakeRaw is not supported on this platform. Callers fall back to reading whole lines.
+func MakeRaw(f *os.File) (func(), error) {
+	return nil, errors.New("raw terminal mode is not supported on this platform")
+}
+
+// DisableEcho is not supported on this platform.
+func DisableEcho(f *os.File) (func(), error) {
+	return nil, errors.New("turning off terminal echo is not supported on this platform")
+}
@@ -0,0 +1,71 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// ttyPath is the controlling terminal, which secrets are prompted for on.
+const ttyPath = "/dev/tty"
+
+func getTermios(fd uintptr) (*syscall.Termios, error) {
+	var t syscall.Termios
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, ioctlReadTermios, uintptr(unsafe.Pointer(&t))); errno != 0 {
+		return nil, errno
+	}
+	return &t, nil
+}
+
+func setTermios(fd uintptr, t *syscall.Termios) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, ioctlWriteTermios, uintptr(unsafe.Pointer(t))); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// MakeRaw puts the terminal f into raw mode so input is read key by key without
+// being echoed. Output processing is left on. The returned function restores
+// the previous state of the terminal.
+func MakeRaw(f *os.File) (func(), error) {
+	old, err := getTermios(f.Fd())
+	if err != nil {
+		return nil, err
+	}
+
+	raw := *old
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP |
+		syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+
+	if err = setTermios(f.Fd(), &raw); err != nil {
+		return nil, err
+	}
+
+	return func() { setTermios(f.Fd(), old) }, nil
+}
+
+// DisableEcho stops the terminal f from echoing input, while still reading it
+// line by line. The returned function restores the previous state of the terminal.
+func DisableEcho(f *os.File) (func(), error) {
+	old, err := getTermios(f.Fd())
+	if err != nil {
+		return nil, err
+	}
+
+	noEcho := *old
+	noEcho.Lflag &^= syscall.ECHO
+	noEcho.Lflag |= syscall.ICANON | syscall.ECHONL
+
+	if err = setTermios(f.Fd(), &noEcho); err != nil {
+		return nil, err
+	}
+
+	return func() { setTermios(f.Fd(), old) }, nil
+}
@@ -0,0 +1,40 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// ttyPath is the console input, which secrets are prompted for on.
+const ttyPath = "CONIN$"
+
+// MakeRaw is not supported on this platform. Callers fall back to reading whole lines.
+func MakeRaw(f *os.File) (func(), error) {
+	return nil, errors.New("raw terminal mode is not supported on this platform")
+}
+
+// DisableEcho stops the console f from echoing input, while still reading it
+// line by line. The returned function restores the previous console mode.
+func DisableEcho(f *os.File) (func(), error) {
+	h := windows.Handle(f.Fd())
+	var old uint32
+	if err := windows.GetConsoleMode(h, &old); err != nil {
+		return nil, err
+	}
+
+	noEcho := old&^windows.ENABLE_ECHO_INPUT | windows.ENABLE_LINE_INPUT | windows.ENABLE_PROCESSED_INPUT
+	if err := windows.SetConsoleMode(h, noEcho); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		windows.SetConsoleMode(h, old)
+		// The console has no ECHONL, so the newline typed after the secret is not shown either.
+		fmt.Fprintln(os.Stderr)
+	}, nil
+}
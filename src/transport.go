@@ -0,0 +1,400 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Transport opens connections to the server.
+type Transport interface {
+	// Dial opens a new connection to the server with dialer.
+	Dial(dialer *net.Dialer) (net.Conn, error)
+	// String names the transport in connection progress messages.
+	String() string
+}
+
+// NewTransport returns the transport used to reach the server described by conf.
+func NewTransport(conf Config) (Transport, error) {
+	if len(conf.Socket) > 0 {
+		if conf.TLS || conf.MTLS {
+			return nil, errors.New("TLS is not supported on unix socket connections")
+		}
+		return unixTransport{path: conf.Socket}, nil
+	}
+
+	if conf.TLS || conf.MTLS {
+		config, err := loadTLSConfig(conf)
+		if err != nil {
+			return nil, err
+		}
+		return tlsTransport{address: conf.Address(), config: config}, nil
+	}
+
+	return tcpTransport{address: conf.Address()}, nil
+}
+
+type tcpTransport struct {
+	address string
+}
+
+func (t tcpTransport) Dial(dialer *net.Dialer) (net.Conn, error) {
+	return dialer.Dial("tcp", t.address)
+}
+
+func (t tcpTransport) String() string {
+	return "TCP"
+}
+
+type unixTransport struct {
+	path string
+}
+
+func (t unixTransport) Dial(dialer *net.Dialer) (net.Conn, error) {
+	return dialer.Dial("unix", t.path)
+}
+
+func (t unixTransport) String() string {
+	return "unix socket"
+}
+
+type tlsTransport struct {
+	address string
+	config  *tls.Config
+}
+
+func (t tlsTransport) Dial(dialer *net.Dialer) (net.Conn, error) {
+	ctx := context.Background()
+	if dialer.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, dialer.Timeout)
+		defer cancel()
+	}
+
+	// The TCP connection is established first, so that only the errors of the
+	// handshake itself are reported as a HandshakeError.
+	rawConn, err := dialer.DialContext(ctx, "tcp", t.address)
+	if isTimeout(err) {
+		return nil, fmt.Errorf("could not connect to %s within %s", t.address, dialer.Timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	config := t.config
+	if len(config.ServerName) == 0 {
+		// As with tls.Dial, the server is verified against the host it was dialed at.
+		host, _, _ := net.SplitHostPort(t.address)
+		config = config.Clone()
+		config.ServerName = host
+	}
+
+	conn := tls.Client(rawConn, config)
+	if err = conn.HandshakeContext(ctx); err != nil {
+		rawConn.Close()
+		if isTimeout(err) {
+			return nil, fmt.Errorf("could not connect to %s within %s", t.address, dialer.Timeout)
+		}
+		return nil, &HandshakeError{Err: err}
+	}
+	return conn, nil
+}
+
+func isTimeout(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded)
+}
+
+// HandshakeError is returned when the TLS handshake with the server fails.
+type HandshakeError struct {
+	Err error
+}
+
+func (e *HandshakeError) Error() string {
+	return "Handshake Error: " + e.Err.Error()
+}
+
+func (e *HandshakeError) Unwrap() error {
+	return e.Err
+}
+
+func (t tlsTransport) String() string {
+	return "TLS"
+}
+
+func loadTLSConfig(conf Config) (*tls.Config, error) {
+	certificates := conf.ClientCertificates
+	if certificates == nil && len(conf.CertKeyPairs) > 0 {
+		var err error
+		if certificates, err = LoadClientCertificates(conf); err != nil {
+			return nil, err
+		}
+	}
+
+	serverCAs, err := loadServerCAs(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	minVersion, err := parseTLSVersion(conf.TLSMinVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	cipherSuites, err := parseCipherSuites(conf.TLSCipherSuites)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		RootCAs:            serverCAs,
+		ServerName:         conf.TLSServerName,
+		MinVersion:         minVersion,
+		CipherSuites:       cipherSuites,
+		InsecureSkipVerify: conf.Insecure,
+	}
+
+	if certificates != nil {
+		config.GetClientCertificate = func(info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return selectClientCertificate(certificates.Get(), info, conf.Verbose), nil
+		}
+	}
+
+	if len(conf.TLSPins) > 0 {
+		pins, err := parsePins(conf.TLSPins)
+		if err != nil {
+			return nil, err
+		}
+		// VerifyConnection runs after the chain is verified, or on its own with --insecure.
+		// The verified chains include the root CA, which the server does not send.
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			for _, chain := range state.VerifiedChains {
+				if verifyPins(chain, pins) == nil {
+					return nil
+				}
+			}
+			return verifyPins(state.PeerCertificates, pins)
+		}
+	}
+
+	return config, nil
+}
+
+// selectClientCertificate returns the first of certificates that was issued by one of
+// the CAs the server accepts and that uses a signature scheme it supports. When none
+// does, the first certificate is sent anyway, as servers do not always list their CAs.
+func selectClientCertificate(certificates []tls.Certificate, info *tls.CertificateRequestInfo, verbose bool) *tls.Certificate {
+	if verbose {
+		var names []string
+		for _, ca := range info.AcceptableCAs {
+			names = append(names, distinguishedName(ca))
+		}
+		if len(names) == 0 {
+			names = append(names, "any CA")
+		}
+		log.Printf("The server accepts client certificates issued by %s", strings.Join(names, "; "))
+	}
+
+	for i := range certificates {
+		if info.SupportsCertificate(&certificates[i]) == nil {
+			if verbose {
+				leaf := certificates[i].Leaf
+				log.Printf("Using client certificate %s, issued by %s", leaf.Subject, leaf.Issuer)
+			}
+			return &certificates[i]
+		}
+	}
+
+	if verbose {
+		leaf := certificates[0].Leaf
+		log.Printf("No client certificate matches the server's CAs, using %s, issued by %s", leaf.Subject, leaf.Issuer)
+	}
+	return &certificates[0]
+}
+
+// distinguishedName formats a DER encoded distinguished name, or returns it as hex if it does not parse.
+func distinguishedName(der []byte) string {
+	var rdns pkix.RDNSequence
+	if rest, err := asn1.Unmarshal(der, &rdns); err != nil || len(rest) > 0 {
+		return fmt.Sprintf("%X", der)
+	}
+	var name pkix.Name
+	name.FillFromRDNSequence(&rdns)
+	return name.String()
+}
+
+// SPKIPin returns the pin of the certificate's public key, as sha256/<base64>.
+func SPKIPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return "sha256/" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// parsePins checks that each pin is a base64 encoded SHA-256 digest prefixed with sha256/.
+func parsePins(pins []string) ([]string, error) {
+	parsed := make([]string, 0, len(pins))
+	for _, pin := range pins {
+		digest, ok := strings.CutPrefix(pin, "sha256/")
+		if !ok {
+			return nil, fmt.Errorf("invalid TLS pin %q, expected sha256/<base64>", pin)
+		}
+		if b, err := base64.StdEncoding.DecodeString(digest); err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("invalid TLS pin %q, expected the base64 encoding of a SHA-256 digest", pin)
+		}
+		parsed = append(parsed, pin)
+	}
+	return parsed, nil
+}
+
+// verifyPins checks that one of the certificates in the chain has a pinned public key.
+func verifyPins(chain []*x509.Certificate, pins []string) error {
+	var presented []string
+	for _, cert := range chain {
+		pin := SPKIPin(cert)
+		if slices.Contains(pins, pin) {
+			return nil
+		}
+		presented = append(presented, fmt.Sprintf("%s (%s)", pin, cert.Subject))
+	}
+	return fmt.Errorf(
+		"TLS pin mismatch: the server presented %s, expected one of %s",
+		strings.Join(presented, ", "), strings.Join(pins, ", "),
+	)
+}
+
+// loadServerCAs returns the pool of CAs the server is verified with: the system trust
+// store, unless NoSystemCA is set, with the --server-ca files and --ca-dir certificates added.
+func loadServerCAs(conf Config) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if !conf.NoSystemCA {
+		system, err := x509.SystemCertPool()
+		if err != nil {
+			return nil, fmt.Errorf("could not load the system trust store, use --no-system-ca to skip it: %s", err)
+		}
+		pool = system
+	}
+
+	files, err := serverCAFiles(conf)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		certs, err := readCertificates(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, cert := range certs {
+			pool.AddCert(cert)
+		}
+	}
+
+	return pool, nil
+}
+
+// serverCAFiles returns the --server-ca files followed by the CA files in --ca-dir.
+func serverCAFiles(conf Config) ([]string, error) {
+	files := slices.Clone(conf.ServerCAs)
+	if len(conf.CADir) > 0 {
+		entries, err := os.ReadDir(conf.CADir)
+		if err != nil {
+			return nil, err
+		}
+		found := 0
+		for _, entry := range entries {
+			switch strings.ToLower(filepath.Ext(entry.Name())) {
+			case ".pem", ".crt", ".cer":
+				if entry.Type().IsRegular() || entry.Type()&os.ModeSymlink != 0 {
+					files = append(files, filepath.Join(conf.CADir, entry.Name()))
+					found++
+				}
+			}
+		}
+		if found == 0 {
+			return nil, fmt.Errorf("%s: no .pem, .crt or .cer files found", conf.CADir)
+		}
+	}
+	return files, nil
+}
+
+// readCertificates reads the PEM encoded X.509 certificates in filePath. It is
+// an error if the file holds none, or if any of them does not parse.
+func readCertificates(filePath string) ([]*x509.Certificate, error) {
+	b, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		if block, b = pem.Decode(b); block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", filePath, err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("%s: no PEM encoded certificates found", filePath)
+	}
+	return certs, nil
+}
+
+// parseTLSVersion parses a TLS version such as 1.2 or TLS1.2. An empty version
+// leaves the choice to crypto/tls.
+func parseTLSVersion(version string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToUpper(version), "TLS") {
+	case "":
+		return 0, nil
+	case "1.0", "10":
+		return tls.VersionTLS10, nil
+	case "1.1", "11":
+		return tls.VersionTLS11, nil
+	case "1.2", "12":
+		return tls.VersionTLS12, nil
+	case "1.3", "13":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unknown TLS version %q, expected 1.0, 1.1, 1.2 or 1.3", version)
+}
+
+// parseCipherSuites returns the IDs of the named cipher suites. Suites that
+// crypto/tls considers insecure are refused.
+func parseCipherSuites(names []string) ([]uint16, error) {
+	var ids []uint16
+	for _, name := range names {
+		id, ok := cipherSuiteID(name, tls.CipherSuites())
+		if !ok {
+			if _, insecure := cipherSuiteID(name, tls.InsecureCipherSuites()); insecure {
+				return nil, fmt.Errorf("cipher suite %s is insecure", name)
+			}
+			return nil, fmt.Errorf("unknown cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func cipherSuiteID(name string, suites []*tls.CipherSuite) (uint16, bool) {
+	for _, suite := range suites {
+		if strings.EqualFold(suite.Name, name) {
+			return suite.ID, true
+		}
+	}
+	return 0, false
+}
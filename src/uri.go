@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// uriParams are the query parameters accepted in a connection URI.
+var uriParams = []string{"timeout", "ca", "cert", "key"}
+
+// ApplyURI sets the connection fields of conf from a connection URI of the form
+//
+//	echovault://[user[:pass]@]host[:port][/db][?timeout=5s&ca=path&cert=path&key=path]
+//	echovaults://... for TLS
+//	unix:///path/to/socket[?db=0]
+//
+// The ca parameter can be repeated. The cert and key parameters are paired in
+// the order they appear and enable mTLS. It returns the names of the fields the
+// URI sets, including those set to their default value.
+func (conf *Config) ApplyURI(raw string) ([]string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var set []string
+	switch u.Scheme {
+	case "echovault", "echovaults":
+		set, err = conf.applyHostURI(u)
+	case "unix":
+		set, err = conf.applySocketURI(u)
+	case "":
+		return nil, errors.New("missing scheme, expected echovault://, echovaults:// or unix://")
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q, expected echovault, echovaults or unix", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if u.User != nil {
+		conf.Username = u.User.Username()
+		set = append(set, "Username")
+		if password, ok := u.User.Password(); ok {
+			conf.Password = password
+			set = append(set, "Password")
+		}
+	}
+
+	query, err := conf.applyURIQuery(u)
+	if err != nil {
+		return nil, err
+	}
+	return append(set, query...), nil
+}
+
+func (conf *Config) applyHostURI(u *url.URL) ([]string, error) {
+	if len(u.Hostname()) == 0 {
+		return nil, errors.New("missing host")
+	}
+	conf.Addr = u.Hostname()
+	conf.Socket = ""
+	set := []string{"Addr", "Socket"}
+
+	if port := u.Port(); len(port) > 0 {
+		p, err := strconv.ParseUint(port, 10, 16)
+		if err != nil || p == 0 {
+			return nil, fmt.Errorf("invalid port %q", port)
+		}
+		conf.Port = uint16(p)
+		set = append(set, "Port")
+	}
+
+	if db := strings.Trim(u.Path, "/"); len(db) > 0 {
+		if err := conf.setDatabase(db); err != nil {
+			return nil, err
+		}
+		set = append(set, "Database")
+	}
+
+	if u.Scheme == "echovaults" {
+		conf.TLS = true
+		set = append(set, "TLS")
+	}
+
+	return set, nil
+}
+
+func (conf *Config) applySocketURI(u *url.URL) ([]string, error) {
+	if len(u.Host) > 0 {
+		return nil, fmt.Errorf("unexpected host %q in unix socket URI, expected unix:///path/to/socket", u.Host)
+	}
+	if len(u.Path) == 0 {
+		return nil, errors.New("missing socket path")
+	}
+	conf.Socket = u.Path
+	return []string{"Socket"}, nil
+}
+
+func (conf *Config) applyURIQuery(u *url.URL) ([]string, error) {
+	query := u.Query()
+
+	for name := range query {
+		if name == "db" && u.Scheme == "unix" {
+			continue
+		}
+		if !slices.Contains(uriParams, name) {
+			return nil, fmt.Errorf("unknown parameter %q, expected one of %s", name, strings.Join(uriParams, ", "))
+		}
+	}
+
+	var set []string
+
+	if db := query.Get("db"); len(db) > 0 && u.Scheme == "unix" {
+		if err := conf.setDatabase(db); err != nil {
+			return nil, err
+		}
+		set = append(set, "Database")
+	}
+
+	if timeout := query.Get("timeout"); len(timeout) > 0 {
+		d, err := time.ParseDuration(timeout)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid timeout %q, expected a duration such as 5s", timeout)
+		}
+		conf.ConnectTimeout = Duration(d)
+		set = append(set, "ConnectTimeout")
+	}
+
+	if cas := query["ca"]; len(cas) > 0 {
+		conf.ServerCAs = cas
+		set = append(set, "ServerCAs")
+	}
+
+	certs, keys := query["cert"], query["key"]
+	if len(certs) != len(keys) {
+		return nil, fmt.Errorf("got %d cert and %d key parameters, each cert needs a key", len(certs), len(keys))
+	}
+	if len(certs) > 0 {
+		conf.CertKeyPairs = nil
+		for i := range certs {
+			conf.CertKeyPairs = append(conf.CertKeyPairs, []string{certs[i], keys[i]})
+		}
+		conf.MTLS = true
+		set = append(set, "CertKeyPairs", "MTLS")
+	}
+
+	if (len(query["ca"]) > 0 || len(certs) > 0) && !conf.TLS && !conf.MTLS {
+		return nil, errors.New("ca, cert and key parameters need the echovaults:// scheme")
+	}
+
+	return set, nil
+}
+
+func (conf *Config) setDatabase(db string) error {
+	n, err := strconv.Atoi(db)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid database %q, expected a non-negative number", db)
+	}
+	conf.Database = n
+	return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestApplyURISetFields(t *testing.T) {
+	tests := []struct {
+		uri  string
+		want []string
+	}{
+		// The port and database are set even when they equal the defaults.
+		{"echovault://myhost:7480/0", []string{"Addr", "Socket", "Port", "Database"}},
+		{"echovault://myhost", []string{"Addr", "Socket"}},
+		{"echovaults://alice:pw@myhost?timeout=5s&ca=ca.pem", []string{"Addr", "Socket", "TLS", "Username", "Password", "ConnectTimeout", "ServerCAs"}},
+		{"echovaults://myhost?cert=c.pem&key=k.pem", []string{"Addr", "Socket", "TLS", "CertKeyPairs", "MTLS"}},
+		{"unix:///run/ev.sock?db=0", []string{"Socket", "Database"}},
+	}
+
+	for _, tt := range tests {
+		conf := DefaultConfig()
+		got, err := conf.ApplyURI(tt.uri)
+		if err != nil {
+			t.Errorf("%s: %s", tt.uri, err)
+			continue
+		}
+		slices.Sort(got)
+		slices.Sort(tt.want)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.uri, got, tt.want)
+		}
+	}
+}
@@ -1,12 +1,13 @@
 package main
 
 import (
-	"bytes"
+	"bufio"
 	"encoding/csv"
 	"errors"
 	"fmt"
 	"io"
-	"slices"
+	"net"
+	"os"
 	"strings"
 
 	"github.com/tidwall/resp"
@@ -18,13 +19,8 @@ func tokenize(comm string) ([]string, error) {
 	return r.Read()
 }
 
-func Encode(comm string) (string, error) {
-	tokens, err := tokenize(comm)
-
-	if err != nil {
-		return "", errors.New("could not parse command")
-	}
-
+// EncodeTokens serializes an already tokenized command. The command name is upper-cased.
+func EncodeTokens(tokens []string) string {
 	str := fmt.Sprintf("*%d\r\n", len(tokens))
 
 	for i, token := range tokens {
@@ -37,51 +33,69 @@ func Encode(comm string) (string, error) {
 
 	str += "\r\n"
 
-	return str, nil
+	return str
 }
 
-func Decode(raw []byte) (resp.Value, error) {
-	rd := resp.NewReader(bytes.NewBuffer(raw))
-	var res resp.Value
-
-	v, _, err := rd.ReadValue()
+// RespReader reads complete RESP values from a long-lived stream such as a
+// server connection. A value is only returned once all of its bytes have
+// arrived, regardless of how the stream is split into reads.
+type RespReader struct {
+	br      *bufio.Reader
+	rd      *resp.Reader
+	partial bool
+}
 
-	if err != nil {
-		return resp.Value{}, err
-	}
+func NewRespReader(r io.Reader) *RespReader {
+	br := bufio.NewReader(r)
+	// resp.NewReader reuses br as it is already a *bufio.Reader of sufficient size.
+	return &RespReader{br: br, rd: resp.NewReader(br)}
+}
 
-	if slices.Contains([]string{"SimpleString", "BulkString", "Integer", "Error"}, v.Type().String()) {
-		return v, nil
+// ReadValue blocks until the next complete RESP value has been read.
+// The server terminates each reply with an additional CRLF, so any
+// blank lines between values are skipped.
+func (r *RespReader) ReadValue() (resp.Value, error) {
+	r.partial = false
+	for {
+		b, err := r.br.Peek(1)
+		if err != nil {
+			return resp.Value{}, err
+		}
+		if b[0] != '\r' && b[0] != '\n' {
+			break
+		}
+		if _, err = r.br.Discard(1); err != nil {
+			return resp.Value{}, err
+		}
 	}
 
-	if v.Type().String() == "Array" {
-		res = v
+	v, _, err := r.rd.ReadValue()
+	if err != nil {
+		r.partial = true
+		return resp.Value{}, err
 	}
 
-	return res, nil
+	return v, nil
 }
 
-func ReadMessage(r io.Reader, delim []byte) ([]byte, error) {
-	buffSize := 8
-	buff := make([]byte, buffSize)
+// Partial reports whether the last ReadValue failed part way through a value. The rest
+// of the value is left unread, so no further values can be read.
+func (r *RespReader) Partial() bool {
+	return r.partial
+}
 
-	var n int
-	var err error
-	var res []byte
+// IsConnectionClosed reports whether err means the server has closed the connection.
+func IsConnectionClosed(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed)
+}
 
-	for {
-		n, err = r.Read(buff)
-		res = append(res, buff...)
-		if n < buffSize || err != nil {
-			break
-		}
-		if bytes.Equal(buff[len(buff)-len(delim):], delim) {
-			break
-		}
-		clear(buff)
+// IsTerminal reports whether f is connected to a terminal.
+func IsTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
 	}
-
-	return res, err
+	return fi.Mode()&os.ModeCharDevice != 0
 }
 
 func IsSubscribeResponse(val resp.Value) bool {
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	"github.com/tidwall/resp"
+)
+
+// byteConn is a net.Conn that returns its data one byte per Read, then io.EOF.
+type byteConn struct {
+	net.Conn
+	data []byte
+}
+
+func (c *byteConn) Read(p []byte) (int, error) {
+	if len(c.data) == 0 {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	p[0] = c.data[0]
+	c.data = c.data[1:]
+	return 1, nil
+}
+
+func readAll(t *testing.T, data string) []resp.Value {
+	t.Helper()
+	r := NewRespReader(&byteConn{data: []byte(data)})
+	var values []resp.Value
+	for {
+		v, err := r.ReadValue()
+		if err == io.EOF && !r.Partial() {
+			return values
+		}
+		if err != nil {
+			t.Fatalf("ReadValue: %s", err)
+		}
+		values = append(values, v)
+	}
+}
+
+func TestRespReaderBulkStringWithCRLF(t *testing.T) {
+	values := readAll(t, "$9\r\nab\r\n\r\ncde\r\n\r\n")
+	if len(values) != 1 {
+		t.Fatalf("got %d values, want 1", len(values))
+	}
+	if got := values[0].String(); got != "ab\r\n\r\ncde" {
+		t.Errorf("got %q, want %q", got, "ab\r\n\r\ncde")
+	}
+}
+
+func TestRespReaderNestedArrays(t *testing.T) {
+	values := readAll(t, "*2\r\n$1\r\na\r\n*2\r\n:5\r\n*1\r\n+OK\r\n\r\n")
+	if len(values) != 1 {
+		t.Fatalf("got %d values, want 1", len(values))
+	}
+	outer := values[0].Array()
+	if len(outer) != 2 || outer[0].String() != "a" {
+		t.Fatalf("got %v, want [a [5 [OK]]]", values[0])
+	}
+	inner := outer[1].Array()
+	if len(inner) != 2 || inner[0].Integer() != 5 {
+		t.Fatalf("got %v, want [5 [OK]]", outer[1])
+	}
+	if innermost := inner[1].Array(); len(innermost) != 1 || innermost[0].String() != "OK" {
+		t.Errorf("got %v, want [OK]", inner[1])
+	}
+}
+
+func TestRespReaderNullBulkString(t *testing.T) {
+	values := readAll(t, "$-1\r\n\r\n")
+	if len(values) != 1 {
+		t.Fatalf("got %d values, want 1", len(values))
+	}
+	if !values[0].IsNull() {
+		t.Errorf("got %v, want a null bulk string", values[0])
+	}
+}
+
+func TestRespReaderBackToBackReplies(t *testing.T) {
+	values := readAll(t, "+OK\r\n\r\n:42\r\n\r\n$3\r\nfoo\r\n\r\n-ERR boom\r\n\r\n")
+	want := []string{"OK", "42", "foo", "ERR boom"}
+	if len(values) != len(want) {
+		t.Fatalf("got %d values, want %d", len(values), len(want))
+	}
+	for i, v := range values {
+		if v.String() != want[i] {
+			t.Errorf("value %d: got %q, want %q", i, v.String(), want[i])
+		}
+	}
+	if values[3].Type() != resp.Error {
+		t.Errorf("value 3: got type %s, want Error", values[3].Type())
+	}
+}
+
+func TestRespReaderEOFPartWayThroughValue(t *testing.T) {
+	r := NewRespReader(&byteConn{data: []byte("+OK\r\n\r\n$10\r\nabc")})
+	if v, err := r.ReadValue(); err != nil || v.String() != "OK" {
+		t.Fatalf("got %v, %v, want OK", v, err)
+	}
+	if r.Partial() {
+		t.Errorf("Partial() after a complete value: got true, want false")
+	}
+
+	if _, err := r.ReadValue(); err == nil {
+		t.Fatal("ReadValue: got no error, want an error")
+	}
+	if !r.Partial() {
+		t.Error("Partial() after EOF part way through a value: got false, want true")
+	}
+}
+
+func TestRespReaderEOFBetweenValues(t *testing.T) {
+	r := NewRespReader(&byteConn{data: []byte("+OK\r\n\r\n")})
+	if _, err := r.ReadValue(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ReadValue(); err != io.EOF {
+		t.Errorf("got %v, want io.EOF", err)
+	}
+	if r.Partial() {
+		t.Error("Partial() after EOF between values: got true, want false")
+	}
+}